@@ -0,0 +1,307 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ENCODING_GZIP     = "gzip"
+	ENCODING_DEFLATE  = "deflate"
+	ENCODING_IDENTITY = "identity"
+)
+
+// Supported content codings, in the order preferred when the client accepts
+// several with the same quality.
+var supportedEncodings = []string{ENCODING_GZIP, ENCODING_DEFLATE}
+
+// CompressionPolicy decides which responses are compressed. Bodies smaller
+// than MinSize bytes, responses whose media type is not in ContentTypes and
+// responses that already have a Content-Encoding are sent as they are.
+// ContentTypes entries are media types, or a type followed by /* to match
+// all of its subtypes. A nil ContentTypes uses the default list, and a zero
+// Level the default compression level.
+type CompressionPolicy struct {
+	MinSize      int
+	ContentTypes []string
+	Level        int
+}
+
+var DefaultCompressionPolicy = CompressionPolicy{
+	MinSize:      256,
+	ContentTypes: defaultCompressibleTypes,
+	Level:        gzip.DefaultCompression,
+}
+
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// Compress compresses responses with DefaultCompressionPolicy.
+func Compress() Middleware {
+	return CompressWith(DefaultCompressionPolicy)
+}
+
+// CompressWith negotiates the content coding of the response from the
+// Accept-Encoding header of the request, following RFC 9110 section 12.5.3,
+// and compresses the responses policy allows. Requests that accept neither a
+// supported coding nor identity are answered with 406 Not Acceptable.
+func CompressWith(policy CompressionPolicy) Middleware {
+	compressor := newCompressor(policy)
+
+	return func(next RouteHandler) RouteHandler {
+		return func(protocol *HTTPProtocol, response *HTTPResponse) {
+			addVary(response, "Accept-Encoding")
+
+			encoding, ok := negotiateEncoding(protocol.Headers["Accept-Encoding"], supportedEncodings)
+			if !ok {
+				response.StatusCode(HttpStatus.NotAcceptable)
+				response.Send()
+				return
+			}
+
+			if encoding != ENCODING_IDENTITY {
+				response.encoding = encoding
+				response.compressor = compressor
+			}
+
+			next(protocol, response)
+		}
+	}
+}
+
+// negotiateEncoding picks the acceptable coding with the highest quality,
+// preferring the supported ones over identity on ties. Without an
+// Accept-Encoding header the response is not encoded.
+func negotiateEncoding(acceptEncoding []string, supported []string) (string, bool) {
+	if acceptEncoding == nil {
+		return ENCODING_IDENTITY, true
+	}
+
+	qualities := map[string]float64{}
+
+	for _, value := range acceptEncoding {
+		for _, element := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(element, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+
+			quality, ok := parseQuality(params)
+			if !ok {
+				continue
+			}
+			qualities[coding] = quality
+		}
+	}
+
+	qualityOf := func(coding string) float64 {
+		if quality, ok := qualities[coding]; ok {
+			return quality
+		}
+		if quality, ok := qualities["*"]; ok {
+			return quality
+		}
+		// identity stays acceptable unless excluded, but only as the last
+		// resort when the client did not rate it.
+		if coding == ENCODING_IDENTITY {
+			return 0.001
+		}
+		return 0
+	}
+
+	best, bestQuality := "", 0.0
+	for _, coding := range append(slices.Clone(supported), ENCODING_IDENTITY) {
+		if quality := qualityOf(coding); quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+
+	return best, best != ""
+}
+
+func parseQuality(params string) (float64, bool) {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if !strings.EqualFold(key, "q") {
+			continue
+		}
+
+		quality, err := strconv.ParseFloat(value, 64)
+		if err != nil || quality < 0 || quality > 1 {
+			return 0, false
+		}
+		return quality, true
+	}
+
+	return 1, true
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type resettableEncoder interface {
+	encoder
+	Reset(writer io.Writer)
+}
+
+// compressor applies a policy, reusing the encoders of finished responses
+// instead of allocating new ones for every request.
+type compressor struct {
+	policy CompressionPolicy
+	pools  map[string]*sync.Pool
+}
+
+func newCompressor(policy CompressionPolicy) *compressor {
+	if policy.ContentTypes == nil {
+		policy.ContentTypes = defaultCompressibleTypes
+	}
+	if policy.Level == 0 {
+		policy.Level = gzip.DefaultCompression
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, policy.Level); err != nil {
+		panic(err)
+	}
+
+	// The deflate content coding is a flate stream inside the zlib format
+	// (RFC 9110 section 8.4.1.2), not a raw flate stream.
+	return &compressor{policy, map[string]*sync.Pool{
+		ENCODING_GZIP: {New: func() any {
+			writer, _ := gzip.NewWriterLevel(io.Discard, policy.Level)
+			return writer
+		}},
+		ENCODING_DEFLATE: {New: func() any {
+			writer, _ := zlib.NewWriterLevel(io.Discard, policy.Level)
+			return writer
+		}},
+	}}
+}
+
+// allows tells whether the response is compressed. size is the length of
+// the body, or -1 when it is unknown.
+func (compressor *compressor) allows(response *HTTPResponse, contentType string, size int) bool {
+	if response.encoding == "" || response.GetHeader("Content-Encoding") != "" {
+		return false
+	}
+	// A HEAD response has no body to encode, its Content-Length is the one
+	// of the body as it is.
+	if _, ok := response.writer.(headWriter); ok {
+		return false
+	}
+	// Content-Range positions refer to the unencoded representation, and
+	// a 304 describes the representation a 200 would have sent.
+	if response.statusCode == HttpStatus.PartialContent || response.statusCode == HttpStatus.NotModified {
+		return false
+	}
+	if size >= 0 && size < compressor.policy.MinSize {
+		return false
+	}
+
+	return matchesMediaType(contentType, compressor.policy.ContentTypes)
+}
+
+// representationEncoding is the content coding the response is going to be
+// sent in, from its Content-Type and a body of size bytes, or -1 when it is
+// unknown. It is empty when the response is sent as it is.
+func (response *HTTPResponse) representationEncoding(size int) string {
+	contentType := response.GetHeader("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	if response.compressor == nil || !response.compressor.allows(response, contentType, size) {
+		return ""
+	}
+
+	return response.encoding
+}
+
+// markEncoded sets the Content-Encoding of a response whose body is
+// compressed, and gives it the entity tag of the encoded representation.
+func (response *HTTPResponse) markEncoded() {
+	response.SetHeader("Content-Encoding", response.encoding)
+
+	if etag := response.GetHeader("ETag"); etag != "" {
+		response.SetHeader("ETag", encodedETag(etag, response.encoding))
+	}
+}
+
+// waitsFor tells whether a streamed body of size bytes so far should be held
+// back because it may still end under the size threshold.
+func (compressor *compressor) waitsFor(response *HTTPResponse, size int) bool {
+	if response.GetHeader("Content-Length") != "" || size >= compressor.policy.MinSize {
+		return false
+	}
+
+	return compressor.allows(response, response.GetHeader("Content-Type"), -1)
+}
+
+func (compressor *compressor) encoder(encoding string, writer io.Writer) encoder {
+	pool := compressor.pools[encoding]
+	pooled := pool.Get().(resettableEncoder)
+	pooled.Reset(writer)
+
+	return &pooledEncoder{pooled, pool}
+}
+
+func (compressor *compressor) encodeBody(encoding string, body []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := compressor.encoder(encoding, &buffer)
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+type pooledEncoder struct {
+	resettableEncoder
+	pool *sync.Pool
+}
+
+func (encoder *pooledEncoder) Close() error {
+	err := encoder.resettableEncoder.Close()
+
+	encoder.resettableEncoder.Reset(io.Discard)
+	encoder.pool.Put(encoder.resettableEncoder)
+
+	return err
+}
+
+func matchesMediaType(contentType string, patterns []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if mediaType == "" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasSuffix(prefix, "/") {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		acceptEncoding []string
+		encoding       string
+		ok             bool
+	}{
+		{nil, "identity", true},
+		{[]string{""}, "identity", true},
+		{[]string{"gzip"}, "gzip", true},
+		{[]string{"deflate"}, "deflate", true},
+		{[]string{"gzip", "deflate"}, "gzip", true},
+		{[]string{"gzip,deflate"}, "gzip", true},
+		{[]string{"gzip;q=0.5", "deflate"}, "deflate", true},
+		{[]string{"GZIP; Q=0.8"}, "gzip", true},
+		{[]string{"gzip;q=0"}, "identity", true},
+		{[]string{"br"}, "identity", true},
+		{[]string{"*"}, "gzip", true},
+		{[]string{"*;q=0.5", "deflate;q=0.7"}, "deflate", true},
+		{[]string{"*", "gzip;q=0"}, "deflate", true},
+		{[]string{"identity;q=0.9", "gzip;q=0.1"}, "identity", true},
+		{[]string{"gzip;q=invalid"}, "identity", true},
+		{[]string{"identity;q=0"}, "", false},
+		{[]string{"br", "identity;q=0"}, "", false},
+		{[]string{"*;q=0"}, "", false},
+		{[]string{"*;q=0", "identity"}, "identity", true},
+	}
+
+	for _, testCase := range cases {
+		encoding, ok := negotiateEncoding(testCase.acceptEncoding, supportedEncodings)
+
+		assert.Equal(t, testCase.encoding, encoding, testCase.acceptEncoding)
+		assert.Equal(t, testCase.ok, ok, testCase.acceptEncoding)
+	}
+}
+
+func compressedRouter(body string) *Router {
+	router := Create()
+
+	router.Use(CompressWith(CompressionPolicy{}))
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(body)
+		response.Send()
+	})
+
+	return &router
+}
+
+func acceptingRequest(path, acceptEncoding string) string {
+	return "GET " + path + " HTTP/1.1\r\nAccept-Encoding: " + acceptEncoding + "\r\n\r\n"
+}
+
+func TestCompressGzip(t *testing.T) {
+	response := doRequest(t, compressedRouter("a gzip body"), acceptingRequest("/", "deflate;q=0.5, gzip"))
+
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", response.Header.Get("Vary"))
+
+	reader, err := gzip.NewReader(response.Body)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(reader)
+	assert.Equal(t, "a gzip body", string(body))
+}
+
+func TestCompressDeflate(t *testing.T) {
+	response := doRequest(t, compressedRouter("a deflate body"), acceptingRequest("/", "deflate, gzip;q=0.5"))
+
+	assert.Equal(t, "deflate", response.Header.Get("Content-Encoding"))
+
+	reader, err := zlib.NewReader(response.Body)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(reader)
+	assert.Equal(t, "a deflate body", string(body))
+}
+
+func TestCompressSkipsUnsupportedClients(t *testing.T) {
+	response := doRequest(t, compressedRouter("plain body"), acceptingRequest("/", "br"))
+	body, _ := io.ReadAll(response.Body)
+
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", response.Header.Get("Vary"))
+	assert.Equal(t, "plain body", string(body))
+}
+
+func TestCompressSkipsEmptyResponses(t *testing.T) {
+	response := doRequest(t, compressedRouter(""), acceptingRequest("/", "gzip"))
+
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+}
+
+func TestCompressNotAcceptable(t *testing.T) {
+	response := doRequest(t, compressedRouter("body"), acceptingRequest("/", "br, identity;q=0"))
+
+	assert.Equal(t, 406, response.StatusCode)
+	assert.Equal(t, "Accept-Encoding", response.Header.Get("Vary"))
+}
+
+func streamedRouter() *Router {
+	router := Create()
+
+	router.Use(CompressWith(CompressionPolicy{}))
+	router.Get("/download", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Type", "text/plain")
+		response.SetHeader("Content-Length", "19")
+		response.Write([]byte("first chunk, "))
+		response.Flush()
+		response.Write([]byte("second"))
+		response.Write([]byte{})
+		response.Close()
+	})
+
+	return &router
+}
+
+func TestCompressStreamedGzip(t *testing.T) {
+	response := doRequest(t, streamedRouter(), acceptingRequest("/download", "gzip"))
+
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", response.Header.Get("Content-Length"))
+
+	reader, err := gzip.NewReader(response.Body)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "first chunk, second", string(body))
+}
+
+func TestCompressStreamedDeflate(t *testing.T) {
+	response := doRequest(t, streamedRouter(), acceptingRequest("/download", "deflate"))
+
+	assert.Equal(t, "deflate", response.Header.Get("Content-Encoding"))
+
+	reader, err := zlib.NewReader(response.Body)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "first chunk, second", string(body))
+}
+
+func TestCompressStreamedIdentity(t *testing.T) {
+	response := doRequest(t, streamedRouter(), acceptingRequest("/download", "identity"))
+	body, err := io.ReadAll(response.Body)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "19", response.Header.Get("Content-Length"))
+	assert.Equal(t, "first chunk, second", string(body))
+}
+
+func TestCompressSkipsEncodedResponses(t *testing.T) {
+	router := Create()
+
+	router.Use(Compress())
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Encoding", "br")
+		response.Write([]byte("already encoded"))
+	})
+
+	response := doRequest(t, &router, acceptingRequest("/", "gzip"))
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "br", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "already encoded", string(body))
+}
+
+func policyRouter(policy CompressionPolicy, handler RouteHandler) *Router {
+	router := Create()
+
+	router.Use(CompressWith(policy))
+	router.Get("/", handler)
+
+	return &router
+}
+
+func TestCompressionPolicyMinSize(t *testing.T) {
+	large := strings.Repeat("a compressible body ", 20)
+
+	router := policyRouter(DefaultCompressionPolicy, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body("hello")
+		response.Send()
+	})
+	response := doRequest(t, router, acceptingRequest("/", "gzip"))
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "hello", string(body))
+
+	router = policyRouter(DefaultCompressionPolicy, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(large)
+		response.Send()
+	})
+	response = doRequest(t, router, acceptingRequest("/", "gzip"))
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+}
+
+func TestCompressionPolicyMinSizeStreamed(t *testing.T) {
+	policy := CompressionPolicy{MinSize: 10}
+
+	router := policyRouter(policy, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Type", "text/plain")
+		response.Write([]byte("tiny"))
+		response.Write([]byte("!"))
+		response.Close()
+	})
+	response := doRequest(t, router, acceptingRequest("/", "gzip"))
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "tiny!", string(body))
+
+	router = policyRouter(policy, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Type", "text/plain")
+		response.Write([]byte("tiny"))
+		response.Write([]byte(" but growing"))
+		response.Close()
+	})
+	response = doRequest(t, router, acceptingRequest("/", "gzip"))
+	reader, err := gzip.NewReader(response.Body)
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(reader)
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "tiny but growing", string(body))
+
+	// A known Content-Length decides right away.
+	router = policyRouter(policy, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Type", "text/plain")
+		response.SetHeader("Content-Length", "4")
+		response.Write([]byte("tiny"))
+		response.Close()
+	})
+	response = doRequest(t, router, acceptingRequest("/", "gzip"))
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, int64(4), response.ContentLength)
+}
+
+func TestCompressionPolicyContentTypes(t *testing.T) {
+	large := strings.Repeat("x", 1024)
+	contentTypes := map[string]string{
+		"text/html; charset=utf-8": "gzip",
+		"application/json":         "gzip",
+		"image/svg+xml":            "gzip",
+		"application/javascript":   "gzip",
+		"image/png":                "",
+		"application/octet-stream": "",
+		"":                         "",
+	}
+
+	for contentType, encoding := range contentTypes {
+		router := policyRouter(DefaultCompressionPolicy, func(protocol *HTTPProtocol, response *HTTPResponse) {
+			if contentType != "" {
+				response.SetHeader("Content-Type", contentType)
+			}
+			response.Write([]byte(large))
+		})
+		response := doRequest(t, router, acceptingRequest("/", "gzip"))
+
+		assert.Equal(t, encoding, response.Header.Get("Content-Encoding"), contentType)
+	}
+
+	router := policyRouter(CompressionPolicy{ContentTypes: []string{"image/png"}}, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Type", "image/png")
+		response.Write([]byte(large))
+	})
+	response := doRequest(t, router, acceptingRequest("/", "gzip"))
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+}
+
+func TestCompressionPolicyLevel(t *testing.T) {
+	large := strings.Repeat("level ", 1024)
+
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression, gzip.HuffmanOnly} {
+		for idx := 0; idx < 2; idx++ {
+			router := policyRouter(CompressionPolicy{Level: level}, func(protocol *HTTPProtocol, response *HTTPResponse) {
+				response.Body(large)
+				response.Send()
+			})
+			response := doRequest(t, router, acceptingRequest("/", "gzip"))
+
+			reader, err := gzip.NewReader(response.Body)
+			assert.Nil(t, err)
+			body, _ := io.ReadAll(reader)
+			assert.Equal(t, large, string(body))
+		}
+	}
+
+	assert.Panics(t, func() { CompressWith(CompressionPolicy{Level: 42}) })
+}
+
+func BenchmarkCompressEncodeBody(b *testing.B) {
+	compressor := newCompressor(DefaultCompressionPolicy)
+	body := []byte(strings.Repeat("a compressible body ", 100))
+
+	b.ReportAllocs()
+	for idx := 0; idx < b.N; idx++ {
+		compressor.encodeBody(ENCODING_GZIP, body)
+	}
+}
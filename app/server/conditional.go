@@ -0,0 +1,247 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validators identify the current representation of a resource, for
+// conditional requests. A zero ETag or LastModified is not known.
+type Validators struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// FileValidators returns the validators of a file: a strong entity tag
+// from its identity, modification time and size, and its modification
+// time. Files without a modification time, as in embed.FS, have none.
+// FileInfos with an ETag method, as those of storages, provide the entity
+// tag themselves.
+func FileValidators(info fs.FileInfo) Validators {
+	if tagged, ok := info.(interface{ ETag() string }); ok && tagged.ETag() != "" {
+		return Validators{ETag: tagged.ETag(), LastModified: info.ModTime()}
+	}
+	if info.ModTime().IsZero() {
+		return Validators{}
+	}
+
+	return Validators{ETag: fileETag(info), LastModified: info.ModTime()}
+}
+
+// ContentETag returns a strong entity tag computed from content.
+func ContentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// CheckPreconditions sets the ETag and Last-Modified headers of response
+// from validators and evaluates the conditional headers of the request in
+// the order of RFC 9110 section 13.2.2. When a condition fails it sends 304
+// Not Modified or 412 Precondition Failed and returns true, and the handler
+// must not send anything else. Set the Content-Type and Content-Length of
+// the response first: If-None-Match is evaluated against the entity tag of
+// the representation that is going to be sent, which differs when the
+// response is compressed.
+func CheckPreconditions(response *HTTPResponse, protocol *HTTPProtocol, validators Validators) bool {
+	size, err := strconv.Atoi(response.GetHeader("Content-Length"))
+	if err != nil {
+		size = -1
+	}
+
+	return checkPreconditions(response, protocol, validators, size)
+}
+
+// checkPreconditions is CheckPreconditions for a body of size bytes, or -1
+// when it is unknown.
+func checkPreconditions(response *HTTPResponse, protocol *HTTPProtocol, validators Validators, size int) bool {
+	setValidators(response, validators)
+
+	encoding := response.representationEncoding(size)
+	switch evaluatePreconditions(protocol, validators, encoding) {
+	case HttpStatus.NotModified:
+		// A 304 stands for the representation a 200 would have sent.
+		if validators.ETag != "" {
+			response.SetHeader("ETag", encodedETag(validators.ETag, encoding))
+		}
+		sendNotModified(response)
+		return true
+	case HttpStatus.PreconditionFailed:
+		sendPreconditionFailed(response)
+		return true
+	}
+
+	return false
+}
+
+// evaluatePreconditions returns the status a failed condition is answered
+// with, or 0 when the request can go on. encoding is the content coding the
+// response is going to be sent in, empty when none.
+//
+// If-None-Match on GET and HEAD compares against the tag of that
+// representation. The other conditions are about the state of the resource
+// and accept the tag of any of its representations, so that a client can
+// write back a file it downloaded compressed.
+func evaluatePreconditions(protocol *HTTPProtocol, validators Validators, encoding string) int {
+	safe := protocol.method == "GET" || protocol.method == "HEAD"
+
+	if ifMatch := headerValue(protocol.Headers, "If-Match"); ifMatch != "" {
+		if !matchesAnyCoding(ifMatch, validators.ETag, true) {
+			return HttpStatus.PreconditionFailed
+		}
+	} else if date, ok := headerDate(protocol.Headers, "If-Unmodified-Since"); ok && !validators.LastModified.IsZero() {
+		if modifiedSince(validators.LastModified, date) {
+			return HttpStatus.PreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := headerValue(protocol.Headers, "If-None-Match"); ifNoneMatch != "" {
+		if safe && matchesETag(ifNoneMatch, encodedETag(validators.ETag, encoding), false) {
+			return HttpStatus.NotModified
+		}
+		if !safe && matchesAnyCoding(ifNoneMatch, validators.ETag, false) {
+			return HttpStatus.PreconditionFailed
+		}
+	} else if date, ok := headerDate(protocol.Headers, "If-Modified-Since"); ok && safe && !validators.LastModified.IsZero() {
+		if !modifiedSince(validators.LastModified, date) {
+			return HttpStatus.NotModified
+		}
+	}
+
+	return 0
+}
+
+func setValidators(response *HTTPResponse, validators Validators) {
+	if validators.ETag != "" {
+		response.SetHeader("ETag", validators.ETag)
+	}
+	if !validators.LastModified.IsZero() {
+		response.SetHeader("Last-Modified", validators.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// matchesETag tells whether etag is in the list of entity tags of an
+// If-Match or If-None-Match header. If-Match compares strongly, so weak tags
+// never match, and If-None-Match weakly. * matches any current
+// representation.
+func matchesETag(header string, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return etag != ""
+	}
+	if etag == "" || (strong && isWeakETag(etag)) {
+		return false
+	}
+
+	for _, candidate := range scanETags(header) {
+		if strong && isWeakETag(candidate) {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanETags splits a comma separated list of entity tags. Commas may appear
+// inside the quotes of a tag.
+func scanETags(header string) []string {
+	var etags []string
+
+	for header = strings.TrimSpace(header); header != ""; header = strings.TrimSpace(header) {
+		start := 0
+		if strings.HasPrefix(header, "W/") {
+			start = 2
+		}
+		if !strings.HasPrefix(header[start:], `"`) {
+			return etags
+		}
+
+		end := strings.IndexByte(header[start+1:], '"')
+		if end < 0 {
+			return etags
+		}
+		end += start + 2
+
+		etags = append(etags, header[:end])
+		header = strings.TrimPrefix(strings.TrimSpace(header[end:]), ",")
+	}
+
+	return etags
+}
+
+// matchesAnyCoding is matchesETag for etag and the tags of its encoded
+// representations.
+func matchesAnyCoding(header string, etag string, strong bool) bool {
+	if matchesETag(header, etag, strong) {
+		return true
+	}
+
+	for _, coding := range supportedEncodings {
+		if matchesETag(header, encodedETag(etag, coding), strong) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodedETag is the entity tag of the representation sent in a content
+// coding. Its bytes differ from the unencoded ones, so RFC 9110 section
+// 8.8.3 requires another strong tag: the coding is added to the opaque tag.
+func encodedETag(etag string, coding string) string {
+	if etag == "" || coding == "" {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+func isWeakETag(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+// modifiedSince compares at the one second precision of HTTP dates.
+func modifiedSince(modTime time.Time, date time.Time) bool {
+	return modTime.Truncate(time.Second).After(date)
+}
+
+func headerDate(headers map[string][]string, key string) (time.Time, bool) {
+	value := headerValue(headers, key)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	date, err := http.ParseTime(value)
+	return date, err == nil
+}
+
+func formatETag(parts ...int64) string {
+	hexParts := make([]string, len(parts))
+	for i, part := range parts {
+		hexParts[i] = fmt.Sprintf("%x", part)
+	}
+
+	return `"` + strings.Join(hexParts, "-") + `"`
+}
+
+// sendNotModified answers with the validators and without a body.
+func sendNotModified(response *HTTPResponse) {
+	delete(response.customHeaders, "Content-Type")
+	delete(response.customHeaders, "Content-Length")
+
+	response.StatusCode(HttpStatus.NotModified)
+	response.Send()
+}
+
+func sendPreconditionFailed(response *HTTPResponse) {
+	response.StatusCode(HttpStatus.PreconditionFailed)
+	response.Send()
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanETags(t *testing.T) {
+	assert.Equal(t, []string{`"a"`, `W/"b"`, `"c,d"`}, scanETags(`"a", W/"b" ,"c,d"`))
+	assert.Equal(t, []string{`"a"`}, scanETags(`"a", b`))
+	assert.Nil(t, scanETags(`"unterminated`))
+}
+
+func TestMatchesETag(t *testing.T) {
+	assert.True(t, matchesETag(`"x", "y"`, `"y"`, true))
+	assert.True(t, matchesETag(`*`, `"y"`, true))
+	assert.False(t, matchesETag(`*`, "", true))
+	assert.False(t, matchesETag(`W/"y"`, `"y"`, true))
+	assert.False(t, matchesETag(`"y"`, `W/"y"`, true))
+	assert.True(t, matchesETag(`W/"y"`, `"y"`, false))
+	assert.True(t, matchesETag(`"y"`, `W/"y"`, false))
+	assert.False(t, matchesETag(`"x"`, `"y"`, false))
+}
+
+func conditionalRouter(validators Validators) *Router {
+	router := Create()
+
+	handler := func(protocol *HTTPProtocol, response *HTTPResponse) {
+		if CheckPreconditions(response, protocol, validators) {
+			return
+		}
+		response.Body("current")
+		response.Send()
+	}
+	router.Get("/resource", handler)
+	router.Post("/resource", handler)
+
+	return &router
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	router := conditionalRouter(Validators{ETag: `"v1"`, LastModified: modTime})
+
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	at := modTime.Format(http.TimeFormat)
+
+	tests := []struct {
+		method  string
+		headers string
+		status  int
+	}{
+		{"GET", "", 200},
+		{"GET", "If-None-Match: \"v1\"\r\n", 304},
+		{"GET", "If-None-Match: W/\"v1\"\r\n", 304},
+		{"GET", "If-None-Match: \"v0\", \"v1\"\r\n", 304},
+		{"GET", "If-None-Match: *\r\n", 304},
+		{"GET", "If-None-Match: \"v0\"\r\n", 200},
+		{"POST", "If-None-Match: \"v1\"\r\n", 412},
+		{"GET", "If-Modified-Since: " + at + "\r\n", 304},
+		{"GET", "If-Modified-Since: " + before + "\r\n", 200},
+		{"GET", "If-Modified-Since: not a date\r\n", 200},
+		{"POST", "If-Modified-Since: " + at + "\r\n", 200},
+		// If-None-Match takes precedence over If-Modified-Since.
+		{"GET", "If-None-Match: \"v0\"\r\nIf-Modified-Since: " + at + "\r\n", 200},
+		{"GET", "If-Match: \"v1\"\r\n", 200},
+		{"GET", "If-Match: W/\"v1\"\r\n", 412},
+		{"POST", "If-Match: \"v0\"\r\n", 412},
+		{"POST", "If-Match: *\r\n", 200},
+		{"POST", "If-Unmodified-Since: " + at + "\r\n", 200},
+		{"POST", "If-Unmodified-Since: " + before + "\r\n", 412},
+		// If-Match takes precedence over If-Unmodified-Since.
+		{"POST", "If-Match: \"v1\"\r\nIf-Unmodified-Since: " + before + "\r\n", 200},
+		{"GET", "If-Match: \"v0\"\r\nIf-None-Match: \"v0\"\r\n", 412},
+	}
+
+	for _, test := range tests {
+		request := test.method + " /resource HTTP/1.1\r\n" + test.headers + "\r\n"
+		response := doRequest(t, router, request)
+
+		assert.Equal(t, test.status, response.StatusCode, request)
+		assert.Equal(t, `"v1"`, response.Header.Get("ETag"), request)
+		assert.Equal(t, at, response.Header.Get("Last-Modified"), request)
+
+		if test.status == 200 {
+			assert.Equal(t, "current", readBody(t, response), request)
+		} else {
+			assert.Equal(t, "", readBody(t, response), request)
+		}
+	}
+}
+
+func TestCheckPreconditionsWithoutValidators(t *testing.T) {
+	router := conditionalRouter(Validators{})
+
+	response := doRequest(t, router, "GET /resource HTTP/1.1\r\nIf-Match: *\r\n\r\n")
+	assert.Equal(t, 412, response.StatusCode)
+
+	response = doRequest(t, router, "GET /resource HTTP/1.1\r\nIf-None-Match: *\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "", response.Header.Get("ETag"))
+	assert.Equal(t, "", response.Header.Get("Last-Modified"))
+
+	response = doRequest(t, router, "GET /resource HTTP/1.1\r\nIf-Modified-Since: Tue, 02 Jan 2024 03:04:05 GMT\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+}
+
+func TestServeFileConditional(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "first"})
+	filePath := filepath.Join(dir, "a.txt")
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(filePath, modTime, modTime))
+
+	router := Create()
+	router.Use(CompressWith(CompressionPolicy{}))
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, filepath.Join(dir, protocol.RouteParams["filename"]))
+	})
+
+	response := doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\n\r\n")
+	etag := response.Header.Get("ETag")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Regexp(t, `^"[0-9a-f-]+"$`, etag)
+	assert.Equal(t, modTime.Format(http.TimeFormat), response.Header.Get("Last-Modified"))
+
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nIf-None-Match: "+etag+"\r\n\r\n")
+	assert.Equal(t, 304, response.StatusCode)
+	assert.Equal(t, etag, response.Header.Get("ETag"))
+	assert.Equal(t, "", response.Header.Get("Content-Type"))
+	assert.Equal(t, "", readBody(t, response))
+
+	// The gzip representation has its own tag, so the identity one does not
+	// validate it.
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\nIf-None-Match: "+etag+"\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	gzipETag := response.Header.Get("ETag")
+	assert.Equal(t, strings.TrimSuffix(etag, `"`)+`-gzip"`, gzipETag)
+
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\nIf-None-Match: "+gzipETag+"\r\n\r\n")
+	assert.Equal(t, 304, response.StatusCode)
+	assert.Equal(t, gzipETag, response.Header.Get("ETag"))
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", readBody(t, response))
+
+	// A 206 is never compressed, so resuming a gzip download sends it whole
+	// again rather than splicing identity bytes onto it.
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\nRange: bytes=2-\r\nIf-Range: "+gzipETag+"\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, gzipETag, response.Header.Get("ETag"))
+
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\nRange: bytes=2-\r\nIf-Range: "+etag+"\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "rst", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nIf-Match: \"stale\"\r\n\r\n")
+	assert.Equal(t, 412, response.StatusCode)
+
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nRange: bytes=0-1\r\nIf-Range: "+etag+"\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "fi", readBody(t, response))
+
+	// Replacing the file changes its entity tag, even with the same size
+	// and modification time.
+	replacement := filepath.Join(dir, "b.txt")
+	assert.Nil(t, os.WriteFile(replacement, []byte("other"), 0o644))
+	assert.Nil(t, os.Chtimes(replacement, modTime, modTime))
+	assert.Nil(t, os.Rename(replacement, filePath))
+
+	response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nIf-None-Match: "+etag+"\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "other", readBody(t, response))
+}
+
+func TestContentETag(t *testing.T) {
+	assert.Equal(t, ContentETag([]byte("a")), ContentETag([]byte("a")))
+	assert.NotEqual(t, ContentETag([]byte("a")), ContentETag([]byte("b")))
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, ContentETag([]byte("a")))
+}
+
+func TestPreconditionsAcrossCodings(t *testing.T) {
+	validators := Validators{ETag: `"abc"`}
+	put := &HTTPProtocol{method: "PUT", Headers: map[string][]string{"If-Match": {`"abc-gzip"`}}}
+	get := &HTTPProtocol{method: "GET", Headers: map[string][]string{"If-None-Match": {`"abc"`}}}
+
+	// Writes depend on the state of the resource, whatever representation
+	// the client saw.
+	assert.Equal(t, 0, evaluatePreconditions(put, validators, ""))
+
+	assert.Equal(t, 304, evaluatePreconditions(get, validators, ""))
+	assert.Equal(t, 0, evaluatePreconditions(get, validators, ENCODING_GZIP))
+	assert.Equal(t, `W/"abc-deflate"`, encodedETag(`W/"abc"`, ENCODING_DEFLATE))
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	CONFLICT_DUPLICATE = "duplicate"
+	CONFLICT_AMBIGUOUS = "ambiguous"
+	CONFLICT_SHADOWED  = "shadowed"
+)
+
+// RouteConflictError reports a route that can never be matched because a
+// route of the same shape was registered first: the same pattern, the same
+// pattern with other param names, or a wildcard where the other route has a
+// named catch-all.
+type RouteConflictError struct {
+	Kind     string
+	Method   string
+	Pattern  string
+	Existing string
+}
+
+func (error RouteConflictError) Error() string {
+	switch error.Kind {
+	case CONFLICT_DUPLICATE:
+		return fmt.Sprintf("Server error: route %s %s is a duplicate of %s %s.", error.Method, error.Pattern, error.Method, error.Existing)
+	case CONFLICT_AMBIGUOUS:
+		return fmt.Sprintf("Server error: route %s %s is ambiguous with %s %s.", error.Method, error.Pattern, error.Method, error.Existing)
+	default:
+		return fmt.Sprintf("Server error: route %s %s is shadowed by %s %s.", error.Method, error.Pattern, error.Method, error.Existing)
+	}
+}
+
+func newRouteConflictError(route, existing *Route) RouteConflictError {
+	kind := CONFLICT_DUPLICATE
+
+	if !slices.Equal(route.paramNames, existing.paramNames) {
+		kind = CONFLICT_AMBIGUOUS
+
+		for idx := range route.paramNames {
+			if (route.paramNames[idx] == "") != (existing.paramNames[idx] == "") {
+				kind = CONFLICT_SHADOWED
+			}
+		}
+	}
+
+	return RouteConflictError{kind, route.method, route.path, existing.path}
+}
+
+// Strict makes conflicting registrations panic instead of being reported by
+// Err.
+//
+// Conflicts are found between routes of the same shape only. Placeholders
+// with different constraints are never reported, even when one constraint
+// accepts every segment the other does, as [id:int] does for
+// [n:regex([0-9]+)] up to the int range: the later route is then reached
+// only by the segments the earlier one refuses, if any.
+func (router *Router) Strict(strict bool) {
+	router.strict = strict
+}
+
+// Err returns the conflicts found while registering routes, including the
+// ones of mounted routers. Listen refuses to start while there are any.
+func (router *Router) Err() error {
+	errs := slices.Clone(router.conflicts)
+
+	for _, mount := range router.mounts {
+		errs = append(errs, mount.router.Err())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteConflicts(t *testing.T) {
+	router := Create()
+	router.Get("/files/[filename]", noopHandler)
+	router.Get("/static/*", noopHandler)
+	router.Get("/users/[id:int]", noopHandler)
+
+	router.Get("/files//[filename]", noopHandler)
+	router.Get("/files/[name]", noopHandler)
+	router.Get("/static/[*path]", noopHandler)
+	router.Get("/users/[name:int]", noopHandler)
+
+	// Not conflicts: other method, other constraint and other precedence.
+	router.Post("/files/[name]", noopHandler)
+	router.Get("/users/[name]", noopHandler)
+	router.Get("*", noopHandler)
+
+	err := router.Err()
+	assert.NotNil(t, err)
+
+	conflicts := []RouteConflictError{}
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var conflict RouteConflictError
+		assert.True(t, errors.As(err, &conflict))
+		conflicts = append(conflicts, conflict)
+	}
+
+	assert.Equal(t, []RouteConflictError{
+		{CONFLICT_DUPLICATE, "GET", "/files//[filename]", "/files/[filename]"},
+		{CONFLICT_AMBIGUOUS, "GET", "/files/[name]", "/files/[filename]"},
+		{CONFLICT_SHADOWED, "GET", "/static/[*path]", "/static/*"},
+		{CONFLICT_AMBIGUOUS, "GET", "/users/[name:int]", "/users/[id:int]"},
+	}, conflicts)
+
+	assert.Equal(t, "Server error: route GET /files/[name] is ambiguous with GET /files/[filename].", conflicts[1].Error())
+	assert.Equal(t, 6, len(router.Routes()))
+	assert.NotNil(t, router.Listen("127.0.0.1:0"))
+}
+
+func TestStrictRouterPanics(t *testing.T) {
+	router := Create()
+	router.Strict(true)
+	router.Get("/files/[filename]", noopHandler)
+
+	assert.PanicsWithError(t, "Server error: route GET /files/[filename] is a duplicate of GET /files/[filename].", func() {
+		router.Get("/files/[filename]", noopHandler)
+	})
+}
+
+func TestStrictRouterAllowsOverlappingConstraints(t *testing.T) {
+	router := Create()
+	router.Strict(true)
+	router.Get("/users/[id:int]", noopHandler)
+
+	// Constraints are not compared, so the overlap is not reported.
+	assert.NotPanics(t, func() {
+		router.Get("/users/[n:regex(^[0-9]+$)]", noopHandler)
+	})
+	assert.Nil(t, router.Err())
+
+	route, _ := router.lookup("GET", "/users/42")
+	assert.Equal(t, "/users/[id:int]", route.path)
+
+	route, _ = router.lookup("GET", "/users/99999999999999999999")
+	assert.Equal(t, "/users/[n:regex(^[0-9]+$)]", route.path)
+}
+
+func TestMountedRouterConflicts(t *testing.T) {
+	admin := Create()
+	admin.Get("/users", noopHandler)
+	admin.Get("/users", noopHandler)
+
+	router := Create()
+	router.Mount("/admin", &admin)
+
+	assert.NotNil(t, router.Err())
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"time"
+)
+
+var ErrServerClosed = ServerError{"server closed."}
+
+// Context is cancelled when the client disconnects, the server shuts down or
+// the request timeout fires, whichever happens first.
+func (protocol *HTTPProtocol) Context() context.Context {
+	if protocol.ctx == nil {
+		return context.Background()
+	}
+
+	return protocol.ctx
+}
+
+// WithContext returns a shallow copy of protocol carrying ctx, which
+// middlewares pass to the next handler to add values or deadlines.
+func (protocol *HTTPProtocol) WithContext(ctx context.Context) *HTTPProtocol {
+	copy := *protocol
+	copy.ctx = ctx
+	return &copy
+}
+
+func (router *Router) RequestTimeout(timeout time.Duration) {
+	router.timeout = timeout
+}
+
+// Shutdown stops accepting connections and cancels the context of every
+// request in flight. Listen then returns ErrServerClosed.
+func (router *Router) Shutdown() error {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	if router.closed {
+		return ErrServerClosed
+	}
+
+	router.closed = true
+	if router.cancel != nil {
+		router.cancel()
+	}
+	if router.listener != nil {
+		return router.listener.Close()
+	}
+
+	return nil
+}
+
+func (router *Router) isClosed() bool {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	return router.closed
+}
+
+func (router *Router) baseContext() context.Context {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	if router.ctx == nil {
+		router.ctx, router.cancel = context.WithCancel(context.Background())
+		if router.closed {
+			router.cancel()
+		}
+	}
+
+	return router.ctx
+}
+
+func (router *Router) requestContext() (context.Context, context.CancelFunc) {
+	if router.timeout > 0 {
+		return context.WithTimeout(router.baseContext(), router.timeout)
+	}
+
+	return context.WithCancel(router.baseContext())
+}
+
+// watchDisconnect cancels the request once the connection is closed, either
+// by the client or by the response. Anything the client sends after the
+// request is discarded.
+func watchDisconnect(reader *bufio.Reader, cancel context.CancelFunc) {
+	buffer := make([]byte, 512)
+
+	for {
+		if _, err := reader.Read(buffer); err != nil {
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitForCancellation(protocol *HTTPProtocol, done chan error) {
+	select {
+	case <-protocol.Context().Done():
+		done <- protocol.Context().Err()
+	case <-time.After(time.Second):
+		done <- nil
+	}
+}
+
+func TestContextCancelledOnClientDisconnect(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	done := make(chan error)
+
+	defer server.Close()
+
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		waitForCancellation(protocol, done)
+	})
+
+	go router.connectionHandler(server)
+	client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	client.Close()
+
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestContextCancelledOnTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	done := make(chan error)
+
+	defer client.Close()
+	defer server.Close()
+
+	router.RequestTimeout(10 * time.Millisecond)
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		waitForCancellation(protocol, done)
+	})
+
+	go router.connectionHandler(server)
+	client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	assert.Equal(t, context.DeadlineExceeded, <-done)
+}
+
+func TestContextCancelledOnShutdown(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	started := make(chan bool)
+	done := make(chan error)
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		started <- true
+		waitForCancellation(protocol, done)
+	})
+
+	go router.connectionHandler(server)
+	client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	<-started
+	assert.Nil(t, router.Shutdown())
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestListenReturnsAfterShutdown(t *testing.T) {
+	router := Create()
+	result := make(chan error)
+
+	go func() { result <- router.Listen("127.0.0.1:0") }()
+
+	for {
+		router.mutex.Lock()
+		listening := router.listener != nil
+		router.mutex.Unlock()
+
+		if listening {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Nil(t, router.Shutdown())
+	assert.Equal(t, ErrServerClosed, <-result)
+}
+
+type contextKey string
+
+func TestMiddlewareDerivesContext(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Use(func(next RouteHandler) RouteHandler {
+		return func(protocol *HTTPProtocol, response *HTTPResponse) {
+			ctx := context.WithValue(protocol.Context(), contextKey("user"), "john")
+			next(protocol.WithContext(ctx), response)
+		}
+	})
+
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(protocol.Context().Value(contextKey("user")).(string))
+		response.Send()
+	})
+
+	go client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+	assert.Nil(t, err)
+	assert.Equal(t, "john", response.Body)
+}
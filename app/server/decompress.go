@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DecompressRequest decodes request bodies sent with a gzip or deflate
+// Content-Encoding, so handlers always see the plain body. Bodies that
+// decompress to more than maxSize bytes are answered with 413 Payload Too
+// Large, to guard against decompression bombs, and bodies in a coding that
+// cannot be decoded with 415 Unsupported Media Type. A maxSize of zero or
+// less uses the body limit of the router. The encoded body is held to that
+// limit too, before it is read, by Router.MaxBodySize.
+func DecompressRequest(maxSize int64) Middleware {
+	return func(next RouteHandler) RouteHandler {
+		return func(protocol *HTTPProtocol, response *HTTPResponse) {
+			limit := maxSize
+			if limit <= 0 {
+				limit = protocol.maxBodySize
+			}
+
+			codings := contentCodings(protocol.Headers["Content-Encoding"])
+			if len(codings) == 0 {
+				next(protocol, response)
+				return
+			}
+
+			for _, coding := range codings {
+				if !slices.Contains(supportedEncodings, coding) {
+					response.SetHeader("Accept-Encoding", strings.Join(supportedEncodings, ", "))
+					response.StatusCode(HttpStatus.UnsupportedMediaType)
+					response.Send()
+					return
+				}
+			}
+
+			body, err := decodeBody([]byte(protocol.Body), codings, limit)
+			if err == errRequestBodyTooLarge {
+				response.StatusCode(HttpStatus.PayloadTooLarge)
+				response.Send()
+				return
+			} else if err != nil {
+				response.StatusCode(HttpStatus.BadRequest)
+				response.Body(err.Error())
+				response.Send()
+				return
+			}
+
+			protocol.Body = string(body)
+			delete(protocol.Headers, "Content-Encoding")
+			protocol.Headers["Content-Length"] = []string{strconv.Itoa(len(body))}
+
+			next(protocol, response)
+		}
+	}
+}
+
+// contentCodings lists the codings applied to the body, in the order they
+// were applied, leaving identity out.
+func contentCodings(contentEncoding []string) []string {
+	codings := []string{}
+
+	for _, value := range contentEncoding {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != ENCODING_IDENTITY {
+				codings = append(codings, coding)
+			}
+		}
+	}
+
+	return codings
+}
+
+func decodeBody(body []byte, codings []string, maxSize int64) ([]byte, error) {
+	for idx := len(codings) - 1; idx >= 0; idx-- {
+		var reader io.ReadCloser
+		var err error
+
+		if codings[idx] == ENCODING_DEFLATE {
+			reader, err = zlib.NewReader(bytes.NewReader(body))
+		} else {
+			reader, err = gzip.NewReader(bytes.NewReader(body))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		body, err = io.ReadAll(io.LimitReader(reader, maxSize+1))
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > maxSize {
+			return nil, errRequestBodyTooLarge
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(body string) string {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(body))
+	writer.Close()
+
+	return buffer.String()
+}
+
+func zlibbed(body string) string {
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	writer.Write([]byte(body))
+	writer.Close()
+
+	return buffer.String()
+}
+
+// decompressRouter decodes the bodies posted to /logs into received.
+func decompressRouter(received **HTTPProtocol) *Router {
+	router := Create()
+
+	router.Post("/logs", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		*received = protocol
+		response.StatusCode(HttpStatus.Created)
+		response.Send()
+	}, DecompressRequest(64))
+
+	return &router
+}
+
+func encodedPost(contentEncoding string, body string) string {
+	return fmt.Sprintf("POST /logs HTTP/1.1\r\nContent-Encoding: %s\r\nContent-Length: %d\r\n\r\n%s", contentEncoding, len(body), body)
+}
+
+func TestDecompressRequestGzip(t *testing.T) {
+	var protocol *HTTPProtocol
+	response := doRequest(t, decompressRouter(&protocol), encodedPost("gzip", gzipped("line 1\nline 2\n")))
+
+	assert.Equal(t, 201, response.StatusCode)
+	assert.Equal(t, "line 1\nline 2\n", protocol.Body)
+	assert.Equal(t, []string{"14"}, protocol.Headers["Content-Length"])
+	assert.NotContains(t, protocol.Headers, "Content-Encoding")
+}
+
+func TestDecompressRequestStackedCodings(t *testing.T) {
+	var protocol *HTTPProtocol
+	response := doRequest(t, decompressRouter(&protocol), encodedPost("deflate, gzip", gzipped(zlibbed("stacked"))))
+
+	assert.Equal(t, 201, response.StatusCode)
+	assert.Equal(t, "stacked", protocol.Body)
+}
+
+func TestDecompressRequestIdentity(t *testing.T) {
+	var protocol *HTTPProtocol
+	response := doRequest(t, decompressRouter(&protocol), encodedPost("identity", "plain"))
+
+	assert.Equal(t, 201, response.StatusCode)
+	assert.Equal(t, "plain", protocol.Body)
+}
+
+func TestDecompressRequestTooLarge(t *testing.T) {
+	var protocol *HTTPProtocol
+	response := doRequest(t, decompressRouter(&protocol), encodedPost("gzip", gzipped(strings.Repeat("a", 65))))
+
+	assert.Equal(t, 413, response.StatusCode)
+	assert.Nil(t, protocol)
+}
+
+func TestDecompressRequestRouterLimit(t *testing.T) {
+	router := Create()
+	router.MaxBodySize(1024)
+	called := false
+
+	router.Post("/logs", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		called = true
+		response.Send()
+	}, DecompressRequest(0))
+
+	// The body is never sent: it is refused from its Content-Length alone.
+	response := doRequest(t, &router, "POST /logs HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: 1073741824\r\n\r\n")
+	assert.Equal(t, 413, response.StatusCode)
+
+	// Without a maxSize of its own, the decoded body is held to the limit
+	// of the router as well.
+	response = doRequest(t, &router, encodedPost("gzip", gzipped(strings.Repeat("a", 2048))))
+	assert.Equal(t, 413, response.StatusCode)
+	assert.False(t, called)
+}
+
+func TestDecompressRequestUnsupportedCoding(t *testing.T) {
+	var protocol *HTTPProtocol
+	response := doRequest(t, decompressRouter(&protocol), encodedPost("br", "compressed"))
+
+	assert.Equal(t, 415, response.StatusCode)
+	assert.Equal(t, "gzip, deflate", response.Header.Get("Accept-Encoding"))
+	assert.Nil(t, protocol)
+}
+
+func TestDecompressRequestCorruptBody(t *testing.T) {
+	var protocol *HTTPProtocol
+	response := doRequest(t, decompressRouter(&protocol), encodedPost("gzip", "not gzip"))
+
+	assert.Equal(t, 400, response.StatusCode)
+	assert.Nil(t, protocol)
+}
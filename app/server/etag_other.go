@@ -0,0 +1,9 @@
+//go:build !unix
+
+package server
+
+import "io/fs"
+
+func fileETag(info fs.FileInfo) string {
+	return formatETag(info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package server
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileETag identifies a file by its inode, so a file replaced by another of
+// the same size and modification time still gets a new entity tag.
+func fileETag(info fs.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return formatETag(int64(stat.Ino), info.ModTime().UnixNano(), info.Size())
+	}
+
+	return formatETag(info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files serves the files of a Storage as a resource, under
+// /prefix/[filename]:
+//
+//   - GET sends the file, with range and conditional request support, and
+//     GET ?meta its FileMeta as JSON. HEAD sends the headers of the GET.
+//   - POST creates the file, and answers 409 Conflict when it exists unless
+//     the overwrite query parameter is set.
+//   - PUT creates or replaces the file. If-Match makes the replace
+//     conditional on the entity tag the client last saw.
+//   - DELETE removes the file.
+//
+// GET /prefix lists the files, as FileServer listings do. Request bodies are
+// written as they are, so route middlewares such as DecompressRequest apply
+// to them. Files are written atomically, and the writes to a name are
+// serialized, so that a conditional write cannot interleave with another
+// one.
+type Files struct {
+	Storage    Storage
+	ShowHidden bool
+	PageSize   int
+	locks      nameLocks
+}
+
+// nameLocks hands out a mutex per name, kept while someone holds it.
+type nameLocks struct {
+	mutex sync.Mutex
+	locks map[string]*nameLock
+}
+
+type nameLock struct {
+	sync.Mutex
+	holders int
+}
+
+// FileMeta is the metadata view of a file.
+type FileMeta struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Type     string    `json:"type"`
+	SHA256   string    `json:"sha256"`
+}
+
+func (router *Router) Files(prefix string, storage Storage, middlewares ...Middleware) *Files {
+	files := &Files{Storage: storage}
+	resource := joinPaths(prefix, "[filename]")
+
+	router.Get(prefix, files.list, middlewares...)
+	router.Get(resource, files.get, middlewares...)
+	router.Post(resource, files.post, middlewares...)
+	router.Put(resource, files.put, middlewares...)
+	router.Delete(resource, files.delete, middlewares...)
+
+	return files
+}
+
+func (files *Files) list(protocol *HTTPProtocol, response *HTTPResponse) {
+	if !strings.HasSuffix(protocol.Path, "/") {
+		redirectToDir(response, protocol)
+		return
+	}
+
+	serveListing(response, protocol, storageFS{files.Storage}, ".", files.ShowHidden, files.PageSize)
+}
+
+func (files *Files) get(protocol *HTTPProtocol, response *HTTPResponse) {
+	name := protocol.RouteParams["filename"]
+
+	if !protocol.Query.Has("meta") {
+		serveFS(response, protocol, storageFS{files.Storage}, name, "", false)
+		return
+	}
+
+	meta, err := files.meta(name)
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+
+	body, err := json.Marshal(meta)
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+
+	response.SetHeader("Content-Type", "application/json")
+	response.Body(string(body))
+	response.Send()
+}
+
+func (files *Files) meta(name string) (*FileMeta, error) {
+	file, err := files.Storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	meta := &FileMeta{
+		Name:     info.Name(),
+		Size:     info.Size(),
+		Modified: info.ModTime().UTC(),
+		Type:     mime.TypeByExtension(filepath.Ext(info.Name())),
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+	}
+	if meta.Type == "" {
+		meta.Type = "application/octet-stream"
+	}
+
+	return meta, nil
+}
+
+func (files *Files) post(protocol *HTTPProtocol, response *HTTPResponse) {
+	name := protocol.RouteParams["filename"]
+	body := strings.NewReader(protocol.Body)
+
+	write, err := files.update(name, protocol, func(existed bool) error {
+		return files.Storage.Create(name, body, protocol.Query.Has("overwrite"))
+	})
+	if errors.Is(err, fs.ErrExist) {
+		response.StatusCode(HttpStatus.Conflict)
+		response.Body("file already exists.")
+		response.Send()
+		return
+	}
+
+	sendWrite(response, write, err, HttpStatus.Created)
+}
+
+func (files *Files) put(protocol *HTTPProtocol, response *HTTPResponse) {
+	name := protocol.RouteParams["filename"]
+	body := strings.NewReader(protocol.Body)
+
+	write, err := files.update(name, protocol, func(existed bool) error {
+		return files.Storage.Create(name, body, true)
+	})
+
+	if write.existed {
+		sendWrite(response, write, err, HttpStatus.NoContent)
+	} else {
+		sendWrite(response, write, err, HttpStatus.Created)
+	}
+}
+
+func (files *Files) delete(protocol *HTTPProtocol, response *HTTPResponse) {
+	name := protocol.RouteParams["filename"]
+
+	write, err := files.update(name, protocol, func(existed bool) error {
+		if !existed {
+			return fs.ErrNotExist
+		}
+		return files.Storage.Delete(name)
+	})
+
+	sendWrite(response, write, err, HttpStatus.NoContent)
+}
+
+// fileWrite is the outcome of a change to a file. It is taken while the
+// name is locked, and sent once the lock is released so that a slow client
+// does not hold up the other writers.
+type fileWrite struct {
+	existed bool
+	failed  bool
+	before  Validators
+	after   Validators
+}
+
+// update evaluates the preconditions of the request against the named file
+// and applies the change when they hold, with the name locked.
+func (files *Files) update(name string, protocol *HTTPProtocol, apply func(existed bool) error) (fileWrite, error) {
+	unlock := files.locks.lock(name)
+	defer unlock()
+
+	var write fileWrite
+	var err error
+
+	if write.before, write.existed, err = files.validators(name); err != nil {
+		return write, err
+	}
+
+	if evaluatePreconditions(protocol, write.before, "") != 0 {
+		write.failed = true
+		return write, nil
+	}
+
+	if err := apply(write.existed); err != nil {
+		return write, err
+	}
+
+	write.after, _, err = files.validators(name)
+	return write, err
+}
+
+// sendWrite answers a change to a file with status, and the validators of
+// the file so the client can make its next write conditional on them.
+func sendWrite(response *HTTPResponse, write fileWrite, err error, status int) {
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+
+	if write.failed {
+		setValidators(response, write.before)
+		sendPreconditionFailed(response)
+		return
+	}
+
+	setValidators(response, write.after)
+	response.StatusCode(status)
+	response.Send()
+}
+
+// validators returns the validators of the named file, and whether it
+// exists. Directories are reported as errors, as they cannot be written.
+func (files *Files) validators(name string) (Validators, bool, error) {
+	info, err := files.Storage.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Validators{}, false, nil
+	} else if err != nil {
+		return Validators{}, false, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return Validators{}, true, &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return FileValidators(info), true, nil
+}
+
+func (locks *nameLocks) lock(name string) (unlock func()) {
+	locks.mutex.Lock()
+	if locks.locks == nil {
+		locks.locks = make(map[string]*nameLock)
+	}
+	lock, ok := locks.locks[name]
+	if !ok {
+		lock = &nameLock{}
+		locks.locks[name] = lock
+	}
+	lock.holders++
+	locks.mutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		locks.mutex.Lock()
+		if lock.holders--; lock.holders == 0 {
+			delete(locks.locks, name)
+		}
+		locks.mutex.Unlock()
+	}
+}
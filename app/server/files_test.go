@@ -0,0 +1,317 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doHeadRequest(t *testing.T, router *Router, target string) (*http.Response, string) {
+	client, server := net.Pipe()
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	go client.Write([]byte("HEAD " + target + " HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	raw, err := readConnectionResponse(client)
+	assert.Nil(t, err)
+
+	response, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), &http.Request{Method: "HEAD"})
+	assert.Nil(t, err)
+
+	_, body, _ := strings.Cut(raw, "\r\n\r\n")
+	return response, body
+}
+
+func filesRouter(t *testing.T, files map[string]string) (*Router, string) {
+	dir := writeFiles(t, files)
+	router := Create()
+	router.Files("/files", NewLocalStorage(dir))
+
+	return &router, dir
+}
+
+func TestHeadRoutes(t *testing.T) {
+	router := Create()
+
+	router.Get("/get", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("X-Method", protocol.Method())
+		response.Body("body of get")
+		response.Send()
+	})
+	router.Head("/head", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("X-Method", "head route")
+		response.Send()
+	})
+
+	response, body := doHeadRequest(t, &router, "/get")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "HEAD", response.Header.Get("X-Method"))
+	assert.Equal(t, "11", response.Header.Get("Content-Length"))
+	assert.Equal(t, "", body)
+
+	response, _ = doHeadRequest(t, &router, "/head")
+	assert.Equal(t, "head route", response.Header.Get("X-Method"))
+
+	response, _ = doHeadRequest(t, &router, "/missing")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestPutAndDeleteRoutes(t *testing.T) {
+	router := Create()
+	group := router.Group("/api")
+
+	group.Put("/items/[id]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body("put " + protocol.RouteParams["id"])
+		response.Send()
+	})
+	group.Delete("/items/[id]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body("delete " + protocol.RouteParams["id"])
+		response.Send()
+	})
+
+	response := doRequest(t, &router, "PUT /api/items/1 HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "put 1", readBody(t, response))
+
+	response = doRequest(t, &router, "DELETE /api/items/2 HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "delete 2", readBody(t, response))
+
+	mounted := Create()
+	mounted.Delete("/[id]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body("mounted delete " + protocol.RouteParams["id"])
+		response.Send()
+	})
+	router.Mount("/mounted", &mounted)
+
+	response = doRequest(t, &router, "DELETE /mounted/3 HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "mounted delete 3", readBody(t, response))
+}
+
+func TestFilesGet(t *testing.T) {
+	router, _ := filesRouter(t, map[string]string{"a.txt": "hello", ".secret": "s"})
+
+	response := doRequest(t, router, "GET /files/a.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "hello", readBody(t, response))
+
+	response = doRequest(t, router, "GET /files/missing.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+
+	head, body := doHeadRequest(t, router, "/files/a.txt")
+	assert.Equal(t, 200, head.StatusCode)
+	assert.Equal(t, "5", head.Header.Get("Content-Length"))
+	assert.Equal(t, "text/plain; charset=utf-8", head.Header.Get("Content-Type"))
+	assert.NotEqual(t, "", head.Header.Get("ETag"))
+	assert.Equal(t, "", body)
+
+	response = doRequest(t, router, "GET /files/ HTTP/1.1\r\nAccept: application/json\r\n\r\n")
+	var listing Listing
+	assert.Nil(t, json.Unmarshal([]byte(readBody(t, response)), &listing))
+	assert.Equal(t, []string{"a.txt"}, entryNames(listing))
+}
+
+func TestFilesMeta(t *testing.T) {
+	router, _ := filesRouter(t, map[string]string{"a.txt": "hello"})
+
+	response := doRequest(t, router, "GET /files/a.txt?meta HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+	var meta FileMeta
+	assert.Nil(t, json.Unmarshal([]byte(readBody(t, response)), &meta))
+
+	sum := sha256.Sum256([]byte("hello"))
+	assert.Equal(t, "a.txt", meta.Name)
+	assert.Equal(t, int64(5), meta.Size)
+	assert.Equal(t, "text/plain; charset=utf-8", meta.Type)
+	assert.Equal(t, hex.EncodeToString(sum[:]), meta.SHA256)
+	assert.False(t, meta.Modified.IsZero())
+
+	response = doRequest(t, router, "GET /files/missing.txt?meta HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestFilesPost(t *testing.T) {
+	router, dir := filesRouter(t, map[string]string{"existing.txt": "old"})
+
+	response := doRequest(t, router, "POST /files/new.txt HTTP/1.1\r\nContent-Length: 3\r\n\r\nnew")
+	assert.Equal(t, 201, response.StatusCode)
+	assert.NotEqual(t, "", response.Header.Get("ETag"))
+
+	content, err := os.ReadFile(filepath.Join(dir, "new.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(content))
+
+	response = doRequest(t, router, "POST /files/existing.txt HTTP/1.1\r\nContent-Length: 3\r\n\r\nnew")
+	assert.Equal(t, 409, response.StatusCode)
+
+	content, _ = os.ReadFile(filepath.Join(dir, "existing.txt"))
+	assert.Equal(t, "old", string(content))
+
+	response = doRequest(t, router, "POST /files/existing.txt?overwrite=true HTTP/1.1\r\nContent-Length: 2\r\n\r\nab")
+	assert.Equal(t, 201, response.StatusCode)
+
+	content, _ = os.ReadFile(filepath.Join(dir, "existing.txt"))
+	assert.Equal(t, "ab", string(content))
+}
+
+func TestFilesPut(t *testing.T) {
+	router, dir := filesRouter(t, map[string]string{})
+
+	response := doRequest(t, router, "PUT /files/a.txt HTTP/1.1\r\nContent-Length: 5\r\n\r\nfirst")
+	assert.Equal(t, 201, response.StatusCode)
+	etag := response.Header.Get("ETag")
+	assert.NotEqual(t, "", etag)
+
+	response = doRequest(t, router, "PUT /files/a.txt HTTP/1.1\r\nContent-Length: 6\r\n\r\nsecond")
+	assert.Equal(t, 204, response.StatusCode)
+	assert.NotEqual(t, etag, response.Header.Get("ETag"))
+	current := response.Header.Get("ETag")
+
+	// The client saw the first version, so its write is refused.
+	response = doRequest(t, router, "PUT /files/a.txt HTTP/1.1\r\nIf-Match: "+etag+"\r\nContent-Length: 5\r\n\r\nstale")
+	assert.Equal(t, 412, response.StatusCode)
+
+	content, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "second", string(content))
+
+	response = doRequest(t, router, "PUT /files/a.txt HTTP/1.1\r\nIf-Match: "+current+"\r\nContent-Length: 5\r\n\r\nthird")
+	assert.Equal(t, 204, response.StatusCode)
+
+	content, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "third", string(content))
+
+	response = doRequest(t, router, "PUT /files/b.txt HTTP/1.1\r\nIf-Match: *\r\nContent-Length: 1\r\n\r\nb")
+	assert.Equal(t, 412, response.StatusCode)
+
+	response = doRequest(t, router, "PUT /files/a.txt HTTP/1.1\r\nIf-None-Match: *\r\nContent-Length: 1\r\n\r\na")
+	assert.Equal(t, 412, response.StatusCode)
+
+	response = doRequest(t, router, "PUT /files/..%2fescape.txt HTTP/1.1\r\nContent-Length: 1\r\n\r\na")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestFilesDelete(t *testing.T) {
+	router, dir := filesRouter(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	response := doRequest(t, router, "DELETE /files/a.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 204, response.StatusCode)
+	assert.Equal(t, "", response.Header.Get("ETag"))
+
+	_, err := os.Stat(filepath.Join(dir, "a.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	response = doRequest(t, router, "DELETE /files/a.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+
+	response = doRequest(t, router, "DELETE /files/b.txt HTTP/1.1\r\nIf-Match: \"stale\"\r\n\r\n")
+	assert.Equal(t, 412, response.StatusCode)
+
+	_, err = os.Stat(filepath.Join(dir, "b.txt"))
+	assert.Nil(t, err)
+}
+
+func TestFilesConcurrentWrites(t *testing.T) {
+	router, dir := filesRouter(t, map[string]string{})
+
+	bodies := map[string]bool{}
+	for _, char := range "abcdefgh" {
+		bodies[strings.Repeat(string(char), 64<<10)] = true
+	}
+
+	var wait sync.WaitGroup
+	for body := range bodies {
+		wait.Add(2)
+
+		go func() {
+			defer wait.Done()
+			request := fmt.Sprintf("PUT /files/shared.txt HTTP/1.1\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+			response := doRequest(t, router, request)
+			assert.Contains(t, []int{201, 204}, response.StatusCode)
+		}()
+
+		go func() {
+			defer wait.Done()
+			response := doRequest(t, router, "GET /files/shared.txt HTTP/1.1\r\n\r\n")
+			if response.StatusCode == 200 {
+				assert.True(t, bodies[readBody(t, response)], "partial file read")
+			}
+		}()
+	}
+	wait.Wait()
+
+	content, err := os.ReadFile(filepath.Join(dir, "shared.txt"))
+	assert.Nil(t, err)
+	assert.True(t, bodies[string(content)])
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFilesConditionalWritesAreSerialized(t *testing.T) {
+	router, _ := filesRouter(t, map[string]string{"a.txt": "base"})
+
+	response := doRequest(t, router, "GET /files/a.txt HTTP/1.1\r\n\r\n")
+	etag := response.Header.Get("ETag")
+
+	// Every writer saw the same version, so only one of them may replace
+	// it.
+	statuses := make(chan int, 8)
+	var wait sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			body := fmt.Sprintf("writer %d", i)
+			request := fmt.Sprintf("PUT /files/a.txt HTTP/1.1\r\nIf-Match: %s\r\nContent-Length: %d\r\n\r\n%s", etag, len(body), body)
+			statuses <- doRequest(t, router, request).StatusCode
+		}()
+	}
+	wait.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for status := range statuses {
+		if status == 204 {
+			succeeded++
+		} else {
+			assert.Equal(t, 412, status)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestFilesListRedirect(t *testing.T) {
+	mounted := Create()
+	mounted.Files("/files", NewMemoryStorage())
+	router := Create()
+	router.Mount("/api", &mounted)
+
+	response := doRequest(t, &router, "GET /api/files?page=2 HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 301, response.StatusCode)
+	assert.Equal(t, "./files/?page=2", response.Header.Get("Location"))
+
+	response = doRequest(t, &router, "GET //api/files HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "./files/", response.Header.Get("Location"))
+
+	response, final := followRedirects(t, &router, "/api/files?page=1")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "/api/files/?page=1", final)
+	assert.Contains(t, readBody(t, response), "<html")
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"slices"
+	"strings"
+)
+
+type mount struct {
+	prefix string
+	router *Router
+}
+
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []Middleware
+}
+
+func (router *Router) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{router, prefix, middlewares}
+}
+
+func (group *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		group.router,
+		joinPaths(group.prefix, prefix),
+		append(slices.Clone(group.middlewares), middlewares...),
+	}
+}
+
+func (group *RouteGroup) Get(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return group.router.Get(joinPaths(group.prefix, path), handler, group.routeMiddlewares(middlewares)...)
+}
+
+func (group *RouteGroup) Post(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return group.router.Post(joinPaths(group.prefix, path), handler, group.routeMiddlewares(middlewares)...)
+}
+
+func (group *RouteGroup) Put(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return group.router.Put(joinPaths(group.prefix, path), handler, group.routeMiddlewares(middlewares)...)
+}
+
+func (group *RouteGroup) Delete(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return group.router.Delete(joinPaths(group.prefix, path), handler, group.routeMiddlewares(middlewares)...)
+}
+
+func (group *RouteGroup) Head(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return group.router.Head(joinPaths(group.prefix, path), handler, group.routeMiddlewares(middlewares)...)
+}
+
+func (group *RouteGroup) routeMiddlewares(middlewares []Middleware) []Middleware {
+	return append(slices.Clone(group.middlewares), middlewares...)
+}
+
+// Mount serves every request under prefix with the mounted router, which
+// sees the path with the prefix stripped and its trailing slash kept. The
+// mounted router keeps its own middlewares and runs them after the ones of
+// the parent router.
+func (router *Router) Mount(prefix string, mounted *Router) {
+	prefixSegments := getPathSegments(prefix)
+
+	handler := func(protocol *HTTPProtocol, response *HTTPResponse) {
+		segments := getPathSegments(protocol.Path)
+		stripped := "/" + strings.Join(segments[len(prefixSegments):], "/")
+		if stripped != "/" && strings.HasSuffix(protocol.Path, "/") {
+			stripped += "/"
+		}
+
+		protocol.Path = stripped
+		mounted.serve(protocol, response)
+	}
+
+	wildcard := joinPaths(prefix, string(WILDCARD_CHAR))
+	router.mounts = append(router.mounts, mount{prefix, mounted})
+
+	for _, route := range []*Route{
+		router.Get(prefix, handler),
+		router.Get(wildcard, handler),
+		router.Post(prefix, handler),
+		router.Post(wildcard, handler),
+		router.Put(prefix, handler),
+		router.Put(wildcard, handler),
+		router.Delete(prefix, handler),
+		router.Delete(wildcard, handler),
+		router.Head(prefix, handler),
+		router.Head(wildcard, handler),
+	} {
+		route.mounted = mounted
+	}
+}
+
+func joinPaths(prefix, path string) string {
+	segments := append(getPathSegments(prefix), getPathSegments(path)...)
+
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupRoutes(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	calls := []string{}
+
+	defer client.Close()
+	defer server.Close()
+
+	api := router.Group("/api/v1", recordingMiddleware("api", &calls))
+	users := api.Group("/users", recordingMiddleware("users", &calls))
+
+	users.Get("/[id]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		calls = append(calls, "handler")
+		response.Body(protocol.RouteParams["id"])
+		response.Send()
+	}, recordingMiddleware("route", &calls))
+
+	go client.Write([]byte("GET /api/v1/users/42 HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+
+	assert.Nil(t, err)
+	assert.Equal(t, response.StatusCode, 200)
+	assert.Equal(t, response.Body, "42")
+	assert.Equal(t, []string{"api", "users", "route", "handler"}, calls)
+}
+
+func TestMountedRouter(t *testing.T) {
+	admin := Create()
+	calls := []string{}
+
+	admin.Use(recordingMiddleware("admin", &calls))
+
+	admin.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body("dashboard")
+		response.Send()
+	})
+
+	admin.Post("/users/[id]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.StatusCode(HttpStatus.Created)
+		response.Body(protocol.Path + " " + protocol.RouteParams["id"])
+		response.Send()
+	})
+
+	router := Create()
+	router.Use(recordingMiddleware("root", &calls))
+	router.Mount("/admin", &admin)
+
+	requests := map[string]string{
+		"GET /admin HTTP/1.1\r\n\r\n":          "dashboard",
+		"POST /admin/users/7 HTTP/1.1\r\n\r\n": "/users/7 7",
+	}
+
+	for request, body := range requests {
+		client, server := net.Pipe()
+		calls = []string{}
+
+		go client.Write([]byte(request))
+		go router.connectionHandler(server)
+
+		response, err := readHTTPResponse(client)
+		client.Close()
+
+		assert.Nil(t, err)
+		assert.Equal(t, response.Body, body)
+		assert.Equal(t, []string{"root", "admin"}, calls)
+	}
+}
+
+func TestMountedRouterNotFound(t *testing.T) {
+	client, server := net.Pipe()
+	admin := Create()
+	router := Create()
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Mount("/admin", &admin)
+
+	go client.Write([]byte("GET /admin/missing HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+
+	assert.Nil(t, err)
+	assert.Equal(t, response.StatusCode, 404)
+}
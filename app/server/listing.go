@@ -0,0 +1,238 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_LISTING_PAGE_SIZE = 100
+
+	SORT_BY_NAME     = "name"
+	SORT_BY_SIZE     = "size"
+	SORT_BY_MODIFIED = "modified"
+	SORT_BY_TYPE     = "type"
+)
+
+// ListingEntry describes a file of a directory listing. Directories have a
+// name ending with a slash and no type.
+type ListingEntry struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Type     string    `json:"type,omitempty"`
+	Dir      bool      `json:"dir"`
+}
+
+// Listing is a page of the entries of a directory.
+type Listing struct {
+	Path    string         `json:"path"`
+	Sort    string         `json:"sort"`
+	Order   string         `json:"order"`
+	Page    int            `json:"page"`
+	Pages   int            `json:"pages"`
+	Total   int            `json:"total"`
+	Entries []ListingEntry `json:"entries"`
+}
+
+// listDirectory reads the directory name of fsys into a Listing, sorted and
+// paginated as the sort, order and page query parameters of the request
+// ask. Directories come first whatever the order.
+func listDirectory(fsys fs.FS, name string, protocol *HTTPProtocol, showHidden bool, pageSize int) (*Listing, error) {
+	dirEntries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ListingEntry{}
+	for _, dirEntry := range dirEntries {
+		if !showHidden && strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+
+		// Symlinks are listed as what they point to. Stat goes through
+		// fsys, so the ones it refuses to follow, such as symlinks out of a
+		// Root, are left out.
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if info, err = fs.Stat(fsys, path.Join(name, dirEntry.Name())); err != nil {
+				continue
+			}
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			continue
+		}
+
+		entry := ListingEntry{Name: dirEntry.Name(), Modified: info.ModTime().UTC(), Dir: info.IsDir()}
+		if entry.Dir {
+			entry.Name += "/"
+		} else {
+			entry.Size = info.Size()
+			entry.Type = mime.TypeByExtension(filepath.Ext(entry.Name))
+			if entry.Type == "" {
+				entry.Type = "application/octet-stream"
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	listing := &Listing{Path: protocol.Path, Sort: SORT_BY_NAME, Order: "asc", Total: len(entries)}
+
+	switch sort := protocol.Query.Get("sort"); sort {
+	case SORT_BY_SIZE, SORT_BY_MODIFIED, SORT_BY_TYPE:
+		listing.Sort = sort
+	}
+	if protocol.Query.Get("order") == "desc" {
+		listing.Order = "desc"
+	}
+	sortEntries(entries, listing.Sort, listing.Order == "desc")
+
+	if pageSize <= 0 {
+		pageSize = DEFAULT_LISTING_PAGE_SIZE
+	}
+	listing.Pages = max(1, (len(entries)+pageSize-1)/pageSize)
+
+	listing.Page, err = strconv.Atoi(protocol.Query.Get("page"))
+	if err != nil || listing.Page < 1 {
+		listing.Page = 1
+	}
+	listing.Page = min(listing.Page, listing.Pages)
+
+	start := (listing.Page - 1) * pageSize
+	listing.Entries = entries[start:min(start+pageSize, len(entries))]
+
+	return listing, nil
+}
+
+func sortEntries(entries []ListingEntry, sort string, descending bool) {
+	slices.SortStableFunc(entries, func(a, b ListingEntry) int {
+		if a.Dir != b.Dir {
+			if a.Dir {
+				return -1
+			}
+			return 1
+		}
+
+		var order int
+		switch sort {
+		case SORT_BY_SIZE:
+			order = cmp.Compare(a.Size, b.Size)
+		case SORT_BY_MODIFIED:
+			order = a.Modified.Compare(b.Modified)
+		case SORT_BY_TYPE:
+			order = cmp.Compare(a.Type, b.Type)
+		}
+		if order == 0 {
+			order = cmp.Compare(a.Name, b.Name)
+		}
+
+		if descending {
+			return -order
+		}
+		return order
+	})
+}
+
+// serveListing sends the listing of the directory name, as JSON when the
+// client accepts application/json and as an HTML page otherwise.
+func serveListing(response *HTTPResponse, protocol *HTTPProtocol, fsys fs.FS, name string, showHidden bool, pageSize int) {
+	listing, err := listDirectory(fsys, name, protocol, showHidden, pageSize)
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+
+	var body strings.Builder
+
+	if acceptsJSON(protocol) {
+		err = json.NewEncoder(&body).Encode(listing)
+		response.SetHeader("Content-Type", "application/json")
+	} else {
+		err = listingTemplate.Execute(&body, listing)
+		response.SetHeader("Content-Type", "text/html; charset=utf-8")
+	}
+
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+
+	response.Body(body.String())
+	response.Send()
+}
+
+func acceptsJSON(protocol *HTTPProtocol) bool {
+	for _, value := range protocol.Headers["Accept"] {
+		mediaType, _, _ := strings.Cut(value, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortLink links to the listing sorted by column, reversing the order when
+// it is already sorted by it.
+func (listing *Listing) sortLink(column string) string {
+	order := "asc"
+	if listing.Sort == column && listing.Order == "asc" {
+		order = "desc"
+	}
+
+	return "?sort=" + column + "&order=" + order
+}
+
+func (listing *Listing) pageLink(page int) string {
+	return "?sort=" + listing.Sort + "&order=" + listing.Order + "&page=" + strconv.Itoa(page)
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"sortLink": (*Listing).sortLink,
+	"pageLink": (*Listing).pageLink,
+	"inc":      func(n int) int { return n + 1 },
+	"dec":      func(n int) int { return n - 1 },
+	"date":     func(t time.Time) string { return t.Format(time.DateTime) },
+	"href":     func(name string) string { return (&url.URL{Path: name}).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<thead><tr>
+<th><a href="{{sortLink . "name"}}">Name</a></th>
+<th><a href="{{sortLink . "size"}}">Size</a></th>
+<th><a href="{{sortLink . "modified"}}">Modified</a></th>
+<th><a href="{{sortLink . "type"}}">Type</a></th>
+</tr></thead>
+<tbody>
+{{- range .Entries}}
+<tr><td><a href="{{href .Name}}">{{.Name}}</a></td><td>{{if not .Dir}}{{.Size}}{{end}}</td><td>{{date .Modified}}</td><td>{{.Type}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- if gt .Pages 1}}
+<p>
+{{- if gt .Page 1}}<a href="{{pageLink . (dec .Page)}}">Previous</a> {{end -}}
+Page {{.Page}} of {{.Pages}}
+{{- if lt .Page .Pages}} <a href="{{pageLink . (inc .Page)}}">Next</a>{{end -}}
+</p>
+{{- end}}
+</body>
+</html>
+`))
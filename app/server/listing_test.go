@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listingRequest(t *testing.T, router *Router, target string) Listing {
+	response := doRequest(t, router, "GET "+target+" HTTP/1.1\r\nAccept: application/json\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+	var listing Listing
+	assert.Nil(t, json.Unmarshal([]byte(readBody(t, response)), &listing))
+
+	return listing
+}
+
+func entryNames(listing Listing) []string {
+	names := []string{}
+	for _, entry := range listing.Entries {
+		names = append(names, entry.Name)
+	}
+
+	return names
+}
+
+func TestStaticListing(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"b.txt":           "bb",
+		"a.json":          "{}",
+		"c.bin":           "cccc",
+		".hidden":         "h",
+		"nested/d.txt":    "d",
+		"site/index.html": "<h1>site</h1>",
+	})
+
+	// Directories are pinned too: their mtimes are set when their files are
+	// written and would otherwise order them by chance.
+	now := time.Now()
+	for i, name := range []string{"nested", "site", "c.bin", "a.json", "b.txt"} {
+		modTime := now.Add(time.Duration(i) * time.Hour)
+		assert.Nil(t, os.Chtimes(filepath.Join(dir, name), modTime, modTime))
+	}
+
+	router := Create()
+	router.Static("/static", dir).Listing = true
+
+	listing := listingRequest(t, &router, "/static/")
+	assert.Equal(t, []string{"nested/", "site/", "a.json", "b.txt", "c.bin"}, entryNames(listing))
+	assert.Equal(t, "/static/", listing.Path)
+	assert.Equal(t, 5, listing.Total)
+	assert.Equal(t, ListingEntry{Name: "a.json", Size: 2, Modified: listing.Entries[2].Modified, Type: "application/json"}, listing.Entries[2])
+	assert.True(t, listing.Entries[0].Dir)
+
+	listing = listingRequest(t, &router, "/static/?sort=size&order=desc")
+	assert.Equal(t, []string{"site/", "nested/", "c.bin", "b.txt", "a.json"}, entryNames(listing))
+
+	listing = listingRequest(t, &router, "/static/?sort=modified")
+	assert.Equal(t, []string{"nested/", "site/", "c.bin", "a.json", "b.txt"}, entryNames(listing))
+
+	listing = listingRequest(t, &router, "/static/nested/")
+	assert.Equal(t, []string{"d.txt"}, entryNames(listing))
+
+	// A directory with an index file is served it instead.
+	response := doRequest(t, &router, "GET /static/site/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "<h1>site</h1>", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /static/ HTTP/1.1\r\n\r\n")
+	body := readBody(t, response)
+	assert.Equal(t, "text/html; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<a href="b.txt">b.txt</a>`)
+	assert.Contains(t, body, `<a href="?sort=name&amp;order=desc">Name</a>`)
+	assert.NotContains(t, body, ".hidden")
+}
+
+func TestStaticListingHidden(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "a", ".hidden": "h"})
+	router := Create()
+
+	fileServer := router.Static("/static", dir)
+	fileServer.Listing = true
+	fileServer.ShowHidden = true
+
+	listing := listingRequest(t, &router, "/static/")
+	assert.Equal(t, []string{".hidden", "a.txt"}, entryNames(listing))
+}
+
+func TestStaticListingDisabled(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "a"})
+	router := Create()
+	router.Static("/static", dir)
+
+	response := doRequest(t, &router, "GET /static/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestStaticListingPagination(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 7; i++ {
+		files[fmt.Sprintf("file%d.txt", i)] = ""
+	}
+	dir := writeFiles(t, files)
+
+	router := Create()
+	fileServer := router.Static("/static", dir)
+	fileServer.Listing = true
+	fileServer.PageSize = 3
+
+	listing := listingRequest(t, &router, "/static/")
+	assert.Equal(t, []string{"file0.txt", "file1.txt", "file2.txt"}, entryNames(listing))
+	assert.Equal(t, 1, listing.Page)
+	assert.Equal(t, 3, listing.Pages)
+	assert.Equal(t, 7, listing.Total)
+
+	listing = listingRequest(t, &router, "/static/?page=3")
+	assert.Equal(t, []string{"file6.txt"}, entryNames(listing))
+
+	listing = listingRequest(t, &router, "/static/?page=9")
+	assert.Equal(t, 3, listing.Page)
+
+	listing = listingRequest(t, &router, "/static/?page=nope")
+	assert.Equal(t, 1, listing.Page)
+
+	response := doRequest(t, &router, "GET /static/?page=2 HTTP/1.1\r\n\r\n")
+	body := readBody(t, response)
+	assert.Contains(t, body, `<a href="?sort=name&amp;order=asc&amp;page=1">Previous</a>`)
+	assert.Contains(t, body, `<a href="?sort=name&amp;order=asc&amp;page=3">Next</a>`)
+}
+
+func TestStaticListingEscapesNames(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"<b>?.txt": ""})
+	router := Create()
+	router.Static("/static", dir).Listing = true
+
+	response := doRequest(t, &router, "GET /static/ HTTP/1.1\r\n\r\n")
+	body := readBody(t, response)
+
+	assert.Contains(t, body, `<a href="%3Cb%3E%3F.txt">&lt;b&gt;?.txt</a>`)
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps files in memory, for tests and for files that do not
+// have to outlive the process. Directories exist as long as there are files
+// in them.
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+// memoryHandle is an open file of a MemoryStorage. It reads from the
+// content the file had when it was opened.
+type memoryHandle struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string]memoryFile)}
+}
+
+func (handle *memoryHandle) Stat() (fs.FileInfo, error) {
+	return handle.info, nil
+}
+
+func (handle *memoryHandle) Close() error {
+	return nil
+}
+
+func (storage *MemoryStorage) Open(name string) (fs.File, error) {
+	if err := validStorageName("open", name); err != nil {
+		return nil, err
+	}
+
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	info, err := storage.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryHandle{bytes.NewReader(storage.files[name].data), info}, nil
+}
+
+func (storage *MemoryStorage) Create(name string, content io.Reader, overwrite bool) error {
+	if err := validStorageName("create", name); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.files[name]; ok && !overwrite {
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+	}
+	if storage.isDir(name) {
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+
+	storage.files[name] = memoryFile{data, time.Now(), ContentETag(data)}
+	return nil
+}
+
+func (storage *MemoryStorage) Stat(name string) (fs.FileInfo, error) {
+	if err := validStorageName("stat", name); err != nil {
+		return nil, err
+	}
+
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	return storage.stat("stat", name)
+}
+
+func (storage *MemoryStorage) stat(op, name string) (fileInfo, error) {
+	if file, ok := storage.files[name]; ok {
+		return fileInfo{name: path.Base(name), size: int64(len(file.data)), modTime: file.modTime, etag: file.etag}, nil
+	}
+	if name == "." || storage.isDir(name) {
+		return fileInfo{name: path.Base(name), modTime: storage.dirModTime(name), dir: true}, nil
+	}
+
+	return fileInfo{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (storage *MemoryStorage) Delete(name string) error {
+	if err := validStorageName("delete", name); err != nil {
+		return err
+	}
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.files[name]; !ok {
+		return &fs.PathError{Op: "delete", Path: name, Err: fs.ErrNotExist}
+	}
+
+	delete(storage.files, name)
+	return nil
+}
+
+func (storage *MemoryStorage) List(dir string) ([]fs.FileInfo, error) {
+	if err := validStorageName("list", dir); err != nil {
+		return nil, err
+	}
+
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	if dir != "." && !storage.isDir(dir) {
+		return nil, &fs.PathError{Op: "list", Path: dir, Err: fs.ErrNotExist}
+	}
+
+	seen := map[string]bool{}
+	infos := []fs.FileInfo{}
+
+	for name, file := range storage.files {
+		rest, ok := strings.CutPrefix(name, dirPrefix(dir))
+		if !ok {
+			continue
+		}
+
+		child, _, nested := strings.Cut(rest, "/")
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		if nested {
+			infos = append(infos, fileInfo{name: child, modTime: storage.dirModTime(path.Join(dir, child)), dir: true})
+		} else {
+			infos = append(infos, fileInfo{name: child, size: int64(len(file.data)), modTime: file.modTime, etag: file.etag})
+		}
+	}
+
+	return infos, nil
+}
+
+func (storage *MemoryStorage) isDir(name string) bool {
+	for key := range storage.files {
+		if strings.HasPrefix(key, dirPrefix(name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dirModTime is the last modification of the files in a directory.
+func (storage *MemoryStorage) dirModTime(name string) time.Time {
+	var modTime time.Time
+
+	for key, file := range storage.files {
+		if strings.HasPrefix(key, dirPrefix(name)) && file.modTime.After(modTime) {
+			modTime = file.modTime
+		}
+	}
+
+	return modTime
+}
+
+// dirPrefix is the prefix of the names of the files in dir.
+func dirPrefix(dir string) string {
+	if dir == "." {
+		return ""
+	}
+
+	return dir + "/"
+}
@@ -0,0 +1,11 @@
+package server
+
+// chain wraps handler so that middlewares[0] runs first and the handler runs
+// last. A middleware short-circuits the chain by not calling next.
+func chain(handler RouteHandler, middlewares []Middleware) RouteHandler {
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		handler = middlewares[idx](handler)
+	}
+
+	return handler
+}
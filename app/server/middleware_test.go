@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next RouteHandler) RouteHandler {
+		return func(protocol *HTTPProtocol, response *HTTPResponse) {
+			*calls = append(*calls, name)
+			next(protocol, response)
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	calls := []string{}
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Use(recordingMiddleware("global 1", &calls), recordingMiddleware("global 2", &calls))
+
+	router.Get("/", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		calls = append(calls, "handler")
+		response.Send()
+	}, recordingMiddleware("route 1", &calls), recordingMiddleware("route 2", &calls))
+
+	go client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	readConnectionResponse(client)
+	assert.Equal(t, []string{"global 1", "global 2", "route 1", "route 2", "handler"}, calls)
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	handlerCalled := false
+
+	defer client.Close()
+	defer server.Close()
+
+	unauthorized := func(next RouteHandler) RouteHandler {
+		return func(protocol *HTTPProtocol, response *HTTPResponse) {
+			response.StatusCode(HttpStatus.NotFound)
+			response.Body("denied")
+			response.Send()
+		}
+	}
+
+	router.Get("/admin", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		handlerCalled = true
+		response.Send()
+	}, unauthorized)
+
+	go client.Write([]byte("GET /admin HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+
+	assert.Nil(t, err)
+	assert.Equal(t, response.StatusCode, 404)
+	assert.Equal(t, response.Body, "denied")
+	assert.False(t, handlerCalled)
+}
+
+func TestGlobalMiddlewareRunsForUnmatchedRoutes(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+	calls := []string{}
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Use(recordingMiddleware("global", &calls))
+
+	go client.Write([]byte("GET /missing HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+
+	assert.Nil(t, err)
+	assert.Equal(t, response.StatusCode, 404)
+	assert.Equal(t, []string{"global"}, calls)
+}
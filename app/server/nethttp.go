@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// FromHTTPHandler adapts a net/http handler, such as net/http/pprof or a
+// stack of http.Handler middlewares, to a RouteHandler. What the handler
+// writes is streamed to the client, and Flush sends it right away.
+func FromHTTPHandler(handler http.Handler) RouteHandler {
+	return func(protocol *HTTPProtocol, response *HTTPResponse) {
+		request, err := newHTTPRequest(protocol)
+		if err != nil {
+			response.StatusCode(HttpStatus.InternalSeverError)
+			response.Body(err.Error())
+			response.Send()
+			return
+		}
+
+		adapter := &httpResponseAdapter{response: response, header: http.Header{}}
+		handler.ServeHTTP(adapter, request)
+
+		if !adapter.wroteHeader {
+			adapter.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+func newHTTPRequest(protocol *HTTPProtocol) (*http.Request, error) {
+	target := protocol.Path
+	if protocol.rawQuery != "" {
+		target += "?" + protocol.rawQuery
+	}
+
+	request, err := http.NewRequestWithContext(protocol.Context(), protocol.method, target, strings.NewReader(protocol.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if major, minor, ok := http.ParseHTTPVersion(protocol.version); ok {
+		request.Proto, request.ProtoMajor, request.ProtoMinor = protocol.version, major, minor
+	}
+
+	// The request parser splits header values on commas, the net/http
+	// handlers expect the field value as it was sent.
+	for key, values := range protocol.Headers {
+		request.Header.Set(key, strings.Join(values, ", "))
+	}
+
+	request.Host = request.Header.Get("Host")
+	request.Header.Del("Host")
+	request.RequestURI = target
+	request.RemoteAddr = protocol.remoteAddr
+
+	return request, nil
+}
+
+type httpResponseAdapter struct {
+	response    *HTTPResponse
+	header      http.Header
+	wroteHeader bool
+}
+
+func (adapter *httpResponseAdapter) Header() http.Header {
+	return adapter.header
+}
+
+func (adapter *httpResponseAdapter) WriteHeader(statusCode int) {
+	if adapter.wroteHeader {
+		return
+	}
+	adapter.wroteHeader = true
+
+	for key, values := range adapter.header {
+		adapter.response.customHeaders[key] = slices.Clone(values)
+	}
+	adapter.response.StatusCode(statusCode)
+}
+
+func (adapter *httpResponseAdapter) Write(b []byte) (int, error) {
+	if !adapter.wroteHeader {
+		adapter.WriteHeader(http.StatusOK)
+	}
+
+	return adapter.response.Write(b)
+}
+
+func (adapter *httpResponseAdapter) Flush() {
+	if !adapter.wroteHeader {
+		adapter.WriteHeader(http.StatusOK)
+	}
+
+	adapter.response.Flush()
+}
+
+// ServeHTTP runs the router under net/http, with the same routing,
+// middlewares and request timeout as Listen.
+func (router *Router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, router.bodyLimit()))
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		http.Error(writer, errRequestBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := request.Context()
+	if router.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, router.timeout)
+		defer cancel()
+	}
+
+	protocol := &HTTPProtocol{
+		version:     request.Proto,
+		method:      request.Method,
+		Path:        request.URL.EscapedPath(),
+		Query:       request.URL.Query(),
+		Headers:     make(map[string][]string),
+		Body:        string(body),
+		rawQuery:    request.URL.RawQuery,
+		remoteAddr:  request.RemoteAddr,
+		maxBodySize: router.bodyLimit(),
+		ctx:         ctx,
+	}
+
+	if request.Host != "" {
+		protocol.Headers["Host"] = []string{request.Host}
+	}
+	for key, values := range request.Header {
+		for _, value := range values {
+			protocol.Headers[key] = append(protocol.Headers[key], strings.Split(value, ", ")...)
+		}
+	}
+
+	response := &HTTPResponse{writer: httpWriter{writer}, customHeaders: make(map[string][]string)}
+
+	defer response.Close()
+
+	router.serve(protocol, response)
+}
+
+type httpWriter struct {
+	http.ResponseWriter
+}
+
+func (writer httpWriter) writeHeader(statusCode int, headers map[string][]string) error {
+	for key, values := range headers {
+		writer.Header()[key] = values
+	}
+
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	writer.WriteHeader(statusCode)
+	return nil
+}
+
+func (writer httpWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (writer httpWriter) Close() error {
+	writer.Flush()
+	return nil
+}
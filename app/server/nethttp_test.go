@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromHTTPHandler(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Post("/upload/[name]", FromHTTPHandler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+
+		assert.Equal(t, "POST", request.Method)
+		assert.Equal(t, "/upload/a.txt", request.URL.Path)
+		assert.Equal(t, "yes", request.URL.Query().Get("overwrite"))
+		assert.Equal(t, "example.com", request.Host)
+		assert.Equal(t, "Mozilla/5.0 (X11, Linux)", request.UserAgent())
+		assert.Equal(t, "hello", string(body))
+		assert.NotNil(t, request.Context())
+
+		writer.Header().Add("Set-Cookie", "a=1")
+		writer.Header().Add("Set-Cookie", "b=2")
+		writer.WriteHeader(http.StatusTeapot)
+		writer.Write([]byte("first "))
+		writer.(http.Flusher).Flush()
+		writer.Write([]byte("second"))
+	})))
+
+	go client.Write([]byte("POST /upload/a.txt?overwrite=yes HTTP/1.1\r\nHost: example.com\r\nUser-Agent: Mozilla/5.0 (X11, Linux)\r\nContent-Length: 5\r\n\r\nhello"))
+	go router.connectionHandler(server)
+
+	response, err := http.ReadResponse(bufio.NewReader(client), nil)
+	assert.Nil(t, err)
+
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, http.StatusTeapot, response.StatusCode)
+	assert.Equal(t, []string{"a=1", "b=2"}, response.Header.Values("Set-Cookie"))
+	assert.Equal(t, "first second", string(body))
+}
+
+func TestFromHTTPHandlerPprof(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Get("/debug/pprof/[*path]", FromHTTPHandler(http.HandlerFunc(pprof.Index)))
+
+	go client.Write([]byte("GET /debug/pprof/goroutine?debug=1 HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readConnectionResponse(client)
+	assert.Nil(t, err)
+	assert.Contains(t, response, "goroutine profile:")
+}
+
+func TestRouterServeHTTP(t *testing.T) {
+	router := Create()
+
+	router.Use(func(next RouteHandler) RouteHandler {
+		return func(protocol *HTTPProtocol, response *HTTPResponse) {
+			response.SetHeader("X-Middleware", "yes")
+			next(protocol, response)
+		}
+	})
+
+	router.Get("/echo/[message]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(protocol.RouteParams["message"] + " " + protocol.Query.Get("suffix") + " " + protocol.Headers["User-Agent"][0])
+		response.Send()
+	})
+
+	router.Post("/stream", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.SetHeader("Content-Type", "text/plain")
+		response.StatusCode(HttpStatus.Created)
+		response.Write([]byte(protocol.Body))
+		response.Flush()
+		response.Write([]byte(" streamed"))
+	})
+
+	server := httptest.NewServer(&router)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/echo/hi?suffix=there", nil)
+	request.Header.Set("User-Agent", "tester")
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "yes", response.Header.Get("X-Middleware"))
+	assert.Equal(t, "hi there tester", string(body))
+
+	response, err = http.Post(server.URL+"/stream", "text/plain", strings.NewReader("data"))
+	assert.Nil(t, err)
+
+	body, _ = io.ReadAll(response.Body)
+	assert.Equal(t, 201, response.StatusCode)
+	assert.Equal(t, "text/plain", response.Header.Get("Content-Type"))
+	assert.Equal(t, "data streamed", string(body))
+
+	response, err = http.Get(server.URL + "/missing")
+	assert.Nil(t, err)
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestRouterServeHTTPBodyLimit(t *testing.T) {
+	router := Create()
+	router.MaxBodySize(8)
+
+	router.Post("/upload", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(protocol.Body)
+		response.Send()
+	})
+
+	server := httptest.NewServer(&router)
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/upload", "text/plain", strings.NewReader("123456789"))
+	assert.Nil(t, err)
+	assert.Equal(t, 413, response.StatusCode)
+
+	response, err = http.Post(server.URL+"/upload", "text/plain", strings.NewReader("12345678"))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "12345678", string(body))
+}
+
+func TestRouterServeHTTPEscapedParams(t *testing.T) {
+	router := Create()
+
+	router.Get("/echo/[message]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(protocol.RouteParams["message"])
+		response.Send()
+	})
+
+	server := httptest.NewServer(&router)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/echo/a%2520b")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "a%20b", string(body))
+
+	raw := doRequest(t, &router, "GET /echo/a%2520b HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "a%20b", readBody(t, raw))
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type routeDocs struct {
+	summary     string
+	description string
+	request     any
+	responses   map[int]any
+	params      map[string]string
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+func (route *Route) Summary(summary string) *Route {
+	route.docs.summary = summary
+	return route
+}
+
+func (route *Route) Description(description string) *Route {
+	route.docs.description = description
+	return route
+}
+
+// Request documents the JSON request body with the schema of the Go type of
+// body, which is only used for reflection.
+func (route *Route) Request(body any) *Route {
+	route.docs.request = body
+	return route
+}
+
+// Response documents the JSON response body sent with statusCode. A nil body
+// documents a response without content.
+func (route *Route) Response(statusCode int, body any) *Route {
+	if route.docs.responses == nil {
+		route.docs.responses = make(map[int]any)
+	}
+
+	route.docs.responses[statusCode] = body
+	return route
+}
+
+func (route *Route) ParamDescription(name, description string) *Route {
+	if route.docs.params == nil {
+		route.docs.params = make(map[string]string)
+	}
+
+	route.docs.params[name] = description
+	return route
+}
+
+// OpenAPI generates an OpenAPI 3.1 document of the registered routes. Routes
+// with an anonymous wildcard cannot be expressed as a path template and are
+// left out.
+func (router *Router) OpenAPI(info OpenAPIInfo) ([]byte, error) {
+	paths := map[string]map[string]any{}
+
+	router.walk("", nil, nil, func(pattern string, constraints []*constraint, route *Route, middlewares []string) {
+		template, params, ok := openAPIPath(pattern, constraints, route.docs.params)
+		if !ok {
+			return
+		}
+
+		if _, ok := paths[template]; !ok {
+			paths[template] = map[string]any{}
+		}
+		paths[template][strings.ToLower(route.method)] = openAPIOperation(route, params)
+	})
+
+	return json.MarshalIndent(map[string]any{
+		"openapi": "3.1.0",
+		"info":    info,
+		"paths":   paths,
+	}, "", "  ")
+}
+
+// ServeOpenAPI registers a route serving the OpenAPI document at path. The
+// document is generated on every request, so routes registered later are
+// included.
+func (router *Router) ServeOpenAPI(path string, info OpenAPIInfo) *Route {
+	return router.Get(path, func(protocol *HTTPProtocol, response *HTTPResponse) {
+		document, err := router.OpenAPI(info)
+		if err != nil {
+			response.StatusCode(HttpStatus.InternalSeverError)
+			response.Body(err.Error())
+			response.Send()
+			return
+		}
+
+		response.SetHeader("Content-Type", "application/json")
+		response.Body(string(document))
+		response.Send()
+	})
+}
+
+// openAPIPath converts pattern to a path template, with the parameters of
+// its placeholders. constraints are the ones of the placeholders, in order.
+func openAPIPath(pattern string, constraints []*constraint, descriptions map[string]string) (string, []map[string]any, bool) {
+	segments := []string{}
+	params := []map[string]any{}
+
+	for _, segment := range getPathSegments(pattern) {
+		if segment == string(WILDCARD_CHAR) {
+			return "", nil, false
+		}
+		if !isPlaceholder(segment) {
+			segments = append(segments, segment)
+			continue
+		}
+
+		var name string
+		schema := map[string]any{"type": "string"}
+
+		if isCatchAll(segment) {
+			name = catchAllName(segment)
+			if name == "" {
+				return "", nil, false
+			}
+		} else {
+			name, _, _ = strings.Cut(stripPlaceholderChars(segment), string(CONSTRAINT_SEPARATOR_CHAR))
+			if constraint := constraints[len(params)]; constraint != nil {
+				schema = constraintSchema(constraint.source)
+			}
+		}
+
+		param := map[string]any{"name": name, "in": "path", "required": true, "schema": schema}
+		if description, ok := descriptions[name]; ok {
+			param["description"] = description
+		}
+
+		segments = append(segments, "{"+name+"}")
+		params = append(params, param)
+	}
+
+	return "/" + strings.Join(segments, "/"), params, true
+}
+
+func constraintSchema(source string) map[string]any {
+	switch {
+	case source == "int":
+		return map[string]any{"type": "integer"}
+	case source == "uuid":
+		return map[string]any{"type": "string", "format": "uuid"}
+	default:
+		return map[string]any{"type": "string", "pattern": source[len("regex(") : len(source)-1]}
+	}
+}
+
+func openAPIOperation(route *Route, params []map[string]any) map[string]any {
+	operation := map[string]any{}
+	responses := map[string]any{}
+
+	if route.docs.summary != "" {
+		operation["summary"] = route.docs.summary
+	}
+	if route.docs.description != "" {
+		operation["description"] = route.docs.description
+	}
+	if route.name != "" {
+		operation["operationId"] = route.name
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+	if route.docs.request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(route.docs.request),
+		}
+	}
+
+	for statusCode, body := range route.docs.responses {
+		response := map[string]any{"description": http.StatusText(statusCode)}
+		if body != nil {
+			response["content"] = jsonContent(body)
+		}
+		responses[strconv.Itoa(statusCode)] = response
+	}
+	if len(responses) == 0 {
+		responses["default"] = map[string]any{"description": "Undocumented response"}
+	}
+
+	operation["responses"] = responses
+	return operation
+}
+
+func jsonContent(body any) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{
+			"schema": schemaOf(reflect.TypeOf(body), map[reflect.Type]bool{}),
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes t as a JSON schema, following the encoding/json rules
+// for struct fields. Recursive types are cut at the first repetition.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]any{}
+		required := []string{}
+
+		for idx := 0; idx < t.NumField(); idx++ {
+			field := t.Field(idx)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" && options == "" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			properties[name] = schemaOf(field.Type, visiting)
+			if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]any{}
+	}
+}
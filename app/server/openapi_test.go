@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type openAPIUser struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Nickname  string    `json:"nickname,omitempty"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	Manager   *openAPIUser
+	password  string
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	router := Create()
+
+	router.Get("/users/[id:int]", noopHandler).
+		Name("get-user").
+		Summary("Fetch a user").
+		ParamDescription("id", "The user id").
+		Response(200, openAPIUser{}).
+		Response(404, nil)
+	router.Post("/users", noopHandler).Request(openAPIUser{})
+	router.Get("/static/[*path]", noopHandler)
+	router.Get("*", noopHandler)
+
+	document, err := router.OpenAPI(OpenAPIInfo{Title: "Users", Version: "1.0.0"})
+	assert.Nil(t, err)
+
+	var spec map[string]any
+	assert.Nil(t, json.Unmarshal(document, &spec))
+
+	assert.Equal(t, "3.1.0", spec["openapi"])
+	assert.Equal(t, map[string]any{"title": "Users", "version": "1.0.0"}, spec["info"])
+
+	paths := spec["paths"].(map[string]any)
+	assert.Equal(t, 3, len(paths))
+	assert.Contains(t, paths, "/static/{path}")
+
+	getUser := paths["/users/{id}"].(map[string]any)["get"].(map[string]any)
+	assert.Equal(t, "get-user", getUser["operationId"])
+	assert.Equal(t, "Fetch a user", getUser["summary"])
+	assert.Equal(t, []any{map[string]any{
+		"name":        "id",
+		"in":          "path",
+		"required":    true,
+		"description": "The user id",
+		"schema":      map[string]any{"type": "integer"},
+	}}, getUser["parameters"])
+	assert.Equal(t, map[string]any{"description": "Not Found"}, getUser["responses"].(map[string]any)["404"])
+
+	schema := getUser["responses"].(map[string]any)["200"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, []any{"id", "email", "tags", "created_at"}, schema["required"])
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, properties["tags"])
+	assert.Equal(t, map[string]any{"type": "string", "format": "date-time"}, properties["created_at"])
+	assert.Equal(t, map[string]any{}, properties["Manager"])
+	assert.NotContains(t, properties, "password")
+
+	createUser := paths["/users"].(map[string]any)["post"].(map[string]any)
+	assert.Contains(t, createUser, "requestBody")
+}
+
+func TestOpenAPIMountedParams(t *testing.T) {
+	posts := Create()
+	posts.Get("/posts/[post:uuid]/[*rest]", noopHandler)
+	posts.Get("/tags/[tag:regex([a-z]+)]", noopHandler)
+
+	router := Create()
+	router.Mount("/users/[id:int]", &posts)
+
+	document, err := router.OpenAPI(OpenAPIInfo{Title: "Posts", Version: "1"})
+	assert.Nil(t, err)
+
+	var spec map[string]any
+	assert.Nil(t, json.Unmarshal(document, &spec))
+	paths := spec["paths"].(map[string]any)
+
+	schemas := func(path string) []any {
+		result := []any{}
+		for _, param := range paths[path].(map[string]any)["get"].(map[string]any)["parameters"].([]any) {
+			result = append(result, param.(map[string]any)["schema"])
+		}
+		return result
+	}
+
+	assert.Equal(t, []any{
+		map[string]any{"type": "integer"},
+		map[string]any{"type": "string", "format": "uuid"},
+		map[string]any{"type": "string"},
+	}, schemas("/users/{id}/posts/{post}/{rest}"))
+	assert.Equal(t, []any{
+		map[string]any{"type": "integer"},
+		map[string]any{"type": "string", "pattern": "[a-z]+"},
+	}, schemas("/users/{id}/tags/{tag}"))
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+
+	defer client.Close()
+	defer server.Close()
+
+	router.ServeOpenAPI("/openapi.json", OpenAPIInfo{Title: "API", Version: "1"})
+
+	go client.Write([]byte("GET /openapi.json HTTP/1.1\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readConnectionResponse(client)
+	assert.Nil(t, err)
+	assert.Contains(t, response, "Content-Type: application/json\r\n")
+	assert.Contains(t, response, `"/openapi.json"`)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A constraint restricts the segments a placeholder accepts, so that a
+// request that does not satisfy it falls through to the other routes. It is
+// written after the parameter name: [id:int], [id:uuid] or
+// [slug:regex(^[a-z-]+$)]. Regular expressions are matched against the whole
+// segment and cannot contain slashes. Segments are checked unescaped, as
+// handlers see them.
+type constraint struct {
+	source string
+	match  func(segment string) bool
+}
+
+const CONSTRAINT_SEPARATOR_CHAR = ':'
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func parsePlaceholder(segment string) (string, *constraint) {
+	placeholder := stripPlaceholderChars(segment)
+
+	name, source, found := strings.Cut(placeholder, string(CONSTRAINT_SEPARATOR_CHAR))
+	if !found {
+		return name, nil
+	}
+
+	return name, parseConstraint(source)
+}
+
+func parseConstraint(source string) *constraint {
+	switch {
+	case source == "int":
+		return &constraint{source, func(segment string) bool {
+			_, err := strconv.Atoi(segment)
+			return err == nil
+		}}
+	case source == "uuid":
+		return &constraint{source, uuidPattern.MatchString}
+	case strings.HasPrefix(source, "regex(") && strings.HasSuffix(source, ")"):
+		expression := source[len("regex(") : len(source)-1]
+		pattern, err := regexp.Compile("^(?:" + expression + ")$")
+		if err != nil {
+			panic(fmt.Sprintf("invalid route constraint %q: %s", source, err))
+		}
+		return &constraint{source, pattern.MatchString}
+	default:
+		panic(fmt.Sprintf("unknown route constraint %q", source))
+	}
+}
+
+// allows tells whether value, an unescaped segment, satisfies the
+// constraint. Both request matching and URL building check it here. A nil
+// constraint allows any value.
+func (constraint *constraint) allows(value string) bool {
+	return constraint == nil || constraint.match(value)
+}
+
+func (protocol *HTTPProtocol) Param(name string) string {
+	return protocol.RouteParams[name]
+}
+
+func (protocol *HTTPProtocol) ParamInt(name string) (int, error) {
+	value, ok := protocol.RouteParams[name]
+	if !ok {
+		return 0, ServerError{fmt.Sprintf("route param %s not found.", name)}
+	}
+
+	return strconv.Atoi(value)
+}
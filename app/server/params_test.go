@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstrainedParams(t *testing.T) {
+	tree := &node{}
+	tree.insert(&Route{path: "/users/[name]"})
+	tree.insert(&Route{path: "/users/[id:int]"})
+	tree.insert(&Route{path: "/users/[uuid:uuid]"})
+	tree.insert(&Route{path: "/posts/[slug:regex(^[a-z-]+$)]"})
+	tree.insert(&Route{path: "*"})
+
+	route, params := tree.lookup("/users/42")
+	assert.Equal(t, "/users/[id:int]", route.path)
+	assert.Equal(t, "42", params["id"])
+
+	route, params = tree.lookup("/users/3f2504e0-4f89-11d3-9a0c-0305e82c3301")
+	assert.Equal(t, "/users/[uuid:uuid]", route.path)
+	assert.Equal(t, "3f2504e0-4f89-11d3-9a0c-0305e82c3301", params["uuid"])
+
+	route, params = tree.lookup("/users/john")
+	assert.Equal(t, "/users/[name]", route.path)
+	assert.Equal(t, "john", params["name"])
+
+	route, params = tree.lookup("/posts/hello-world")
+	assert.Equal(t, "/posts/[slug:regex(^[a-z-]+$)]", route.path)
+	assert.Equal(t, "hello-world", params["slug"])
+
+	route, _ = tree.lookup("/posts/Hello_World")
+	assert.Equal(t, "*", route.path)
+}
+
+func TestConstrainedParamsAreWholeSegment(t *testing.T) {
+	assert.True(t, pathMatch("/a/123", "/a/[id:regex([0-9]+)]"))
+	assert.False(t, pathMatch("/a/123abc", "/a/[id:regex([0-9]+)]"))
+	assert.False(t, pathMatch("/a/12.5", "/a/[id:int]"))
+}
+
+func TestConstrainedParamsAreUnescaped(t *testing.T) {
+	router := Create()
+	router.Get("/a/[x:regex([a-z ]+)]", noopHandler).Name("spaced")
+
+	assert.True(t, pathMatch("/a/a%20b", "/a/[x:regex([a-z ]+)]"))
+	assert.False(t, pathMatch("/a/a%2Fb", "/a/[x:regex([a-z ]+)]"))
+
+	// The URL built for a value routes back to the same route with it.
+	path, err := router.URL("spaced", map[string]string{"x": "a b"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/a/a%20b", path)
+
+	route, params := router.lookup("GET", path)
+	assert.Equal(t, "/a/[x:regex([a-z ]+)]", route.path)
+	assert.Equal(t, "a b", params["x"])
+}
+
+func TestInvalidConstraintPanics(t *testing.T) {
+	assert.Panics(t, func() { (&node{}).insert(&Route{path: "/a/[id:float]"}) })
+	assert.Panics(t, func() { (&node{}).insert(&Route{path: "/a/[id:regex(()]"}) })
+}
+
+func TestParamAccessors(t *testing.T) {
+	protocol := HTTPProtocol{RouteParams: map[string]string{"id": "42", "name": "john"}}
+
+	id, err := protocol.ParamInt("id")
+	assert.Nil(t, err)
+	assert.Equal(t, 42, id)
+	assert.Equal(t, "john", protocol.Param("name"))
+
+	_, err = protocol.ParamInt("name")
+	assert.NotNil(t, err)
+
+	_, err = protocol.ParamInt("missing")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const RANGE_UNIT_BYTES = "bytes"
+
+var (
+	errInvalidRange       = ServerError{"invalid range."}
+	errUnsatisfiableRange = ServerError{"unsatisfiable range."}
+)
+
+// byteRange is a part of a representation, length bytes from start.
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("%s %d-%d/%d", RANGE_UNIT_BYTES, r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header, following RFC 9110 section 14.1, for a
+// representation of size bytes. Ranges that start past the end are dropped,
+// and errUnsatisfiableRange is returned when none is left. A header that is
+// not a valid bytes range set returns errInvalidRange, and is ignored.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	unit, set, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), RANGE_UNIT_BYTES) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+
+		// A suffix range, -n, is the last n bytes.
+		if first == "" {
+			length, err := parseRangePosition(last)
+			if err != nil {
+				return nil, err
+			}
+			if length == 0 || size == 0 {
+				continue
+			}
+			length = min(length, size)
+			ranges = append(ranges, byteRange{size - length, length})
+			continue
+		}
+
+		start, err := parseRangePosition(first)
+		if err != nil {
+			return nil, err
+		}
+
+		end := size - 1
+		if last != "" {
+			if end, err = parseRangePosition(last); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, errInvalidRange
+			}
+			end = min(end, size-1)
+		}
+
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start, end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+
+	return ranges, nil
+}
+
+func sumRanges(ranges []byteRange) int64 {
+	var sum int64
+	for _, r := range ranges {
+		sum += r.length
+	}
+
+	return sum
+}
+
+func parseRangePosition(position string) (int64, error) {
+	if position == "" || strings.TrimLeft(position, "0123456789") != "" {
+		return 0, errInvalidRange
+	}
+
+	value, err := strconv.ParseInt(position, 10, 64)
+	if err != nil {
+		return 0, errInvalidRange
+	}
+
+	return value, nil
+}
+
+// rangeApplies evaluates If-Range: the Range header is only honoured while
+// the representation still matches the validator the client has, a strong
+// entity tag or a Last-Modified date.
+func rangeApplies(protocol *HTTPProtocol, response *HTTPResponse, modTime time.Time) bool {
+	ifRange := headerValue(protocol.Headers, "If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) {
+		etag := response.GetHeader("ETag")
+		return etag != "" && etag == ifRange
+	}
+
+	date, err := http.ParseTime(ifRange)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+
+	return modTime.Truncate(time.Second).Equal(date)
+}
+
+// serveRanges sends the ranges of content as a 206 Partial Content
+// response, a single one as it is and several as multipart/byteranges. With
+// head set only the header is sent, content is not read.
+func serveRanges(response *HTTPResponse, contentType string, size int64, content io.ReadSeeker, ranges []byteRange, head bool) {
+	response.StatusCode(HttpStatus.PartialContent)
+
+	if len(ranges) == 1 {
+		response.SetHeader("Content-Range", ranges[0].contentRange(size))
+		response.SetHeader("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+
+		if head {
+			response.Close()
+			return
+		}
+		if _, err := content.Seek(ranges[0].start, io.SeekStart); err == nil {
+			io.CopyN(response, content, ranges[0].length)
+		}
+		response.Close()
+		return
+	}
+
+	boundary := newBoundary()
+	headers := make([]string, len(ranges))
+	length := int64(len(multipartClosing(boundary)))
+
+	for i, r := range ranges {
+		headers[i] = fmt.Sprintf("\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n",
+			boundary, contentType, r.contentRange(size))
+		length += int64(len(headers[i])) + r.length
+	}
+
+	response.SetHeader("Content-Type", "multipart/byteranges; boundary="+boundary)
+	response.SetHeader("Content-Length", strconv.FormatInt(length, 10))
+
+	if head {
+		response.Close()
+		return
+	}
+
+	for i, r := range ranges {
+		if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+			break
+		}
+		io.WriteString(response, headers[i])
+		io.CopyN(response, content, r.length)
+	}
+	io.WriteString(response, multipartClosing(boundary))
+
+	response.Close()
+}
+
+func sendRangeNotSatisfiable(response *HTTPResponse, size int64) {
+	response.SetHeader("Content-Range", fmt.Sprintf("%s */%d", RANGE_UNIT_BYTES, size))
+	response.StatusCode(HttpStatus.RangeNotSatisfiable)
+	response.Send()
+}
+
+func multipartClosing(boundary string) string {
+	return fmt.Sprintf("\r\n--%s--\r\n", boundary)
+}
+
+func newBoundary() string {
+	buffer := make([]byte, 16)
+	rand.Read(buffer)
+
+	return hex.EncodeToString(buffer)
+}
+
+// headerValue joins back the values of a request header, which the parser
+// splits on commas, for headers such as dates that contain them.
+func headerValue(headers map[string][]string, key string) string {
+	return strings.TrimSpace(strings.Join(headers[key], ", "))
+}
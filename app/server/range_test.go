@@ -0,0 +1,164 @@
+package server
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		ranges []byteRange
+		err    error
+	}{
+		{"bytes=0-4", []byteRange{{0, 5}}, nil},
+		{"bytes=5-", []byteRange{{5, 5}}, nil},
+		{"bytes=-3", []byteRange{{7, 3}}, nil},
+		{"bytes=-20", []byteRange{{0, 10}}, nil},
+		{"bytes=8-20", []byteRange{{8, 2}}, nil},
+		{"Bytes=0-0, 2-3", []byteRange{{0, 1}, {2, 2}}, nil},
+		{"bytes=0-1,20-30", []byteRange{{0, 2}}, nil},
+		{"bytes=10-", nil, errUnsatisfiableRange},
+		{"bytes=-0", nil, errUnsatisfiableRange},
+		{"bytes=4-2", nil, errInvalidRange},
+		{"bytes=a-b", nil, errInvalidRange},
+		{"bytes=+1-2", nil, errInvalidRange},
+		{"bytes=1", nil, errInvalidRange},
+		{"items=0-1", nil, errInvalidRange},
+		{"", nil, errInvalidRange},
+	}
+
+	for _, test := range tests {
+		ranges, err := parseRange(test.header, 10)
+
+		assert.Equal(t, test.err, err, test.header)
+		assert.Equal(t, test.ranges, ranges, test.header)
+	}
+}
+
+func TestServeFileRanges(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"digits.txt": "0123456789"})
+	router := Create()
+
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, filepath.Join(dir, protocol.RouteParams["filename"]))
+	})
+
+	response := doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "bytes", response.Header.Get("Accept-Ranges"))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=2-5\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "bytes 2-5/10", response.Header.Get("Content-Range"))
+	assert.Equal(t, "4", response.Header.Get("Content-Length"))
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Equal(t, "2345", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=-3\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "789", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=20-\r\n\r\n")
+	assert.Equal(t, 416, response.StatusCode)
+	assert.Equal(t, "bytes */10", response.Header.Get("Content-Range"))
+	assert.Equal(t, "", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: lines=1-2\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "0123456789", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=0-9, 0-9\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "0123456789", readBody(t, response))
+}
+
+func TestServeFileMultipleRanges(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"digits.txt": "0123456789"})
+	router := Create()
+
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, filepath.Join(dir, protocol.RouteParams["filename"]))
+	})
+
+	response := doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=0-1, 5-6, -1\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "", response.Header.Get("Content-Range"))
+
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	body := readBody(t, response)
+	assert.Equal(t, response.Header.Get("Content-Length"), strconv.Itoa(len(body)))
+
+	reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	expected := []struct{ contentRange, content string }{
+		{"bytes 0-1/10", "01"},
+		{"bytes 5-6/10", "56"},
+		{"bytes 9-9/10", "9"},
+	}
+
+	for _, part := range expected {
+		next, err := reader.NextPart()
+		assert.Nil(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", next.Header.Get("Content-Type"))
+		assert.Equal(t, part.contentRange, next.Header.Get("Content-Range"))
+
+		content, _ := io.ReadAll(next)
+		assert.Equal(t, part.content, string(content))
+	}
+
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServeFileIfRange(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"digits.txt": "0123456789"})
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "digits.txt"), modTime, modTime))
+
+	router := Create()
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, filepath.Join(dir, protocol.RouteParams["filename"]))
+	})
+
+	current := modTime.Format(http.TimeFormat)
+	stale := modTime.Add(-time.Hour).Format(http.TimeFormat)
+
+	response := doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=0-1\r\nIf-Range: "+current+"\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "01", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=0-1\r\nIf-Range: "+stale+"\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "0123456789", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nRange: bytes=0-1\r\nIf-Range: \"unknown\"\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+}
+
+func TestServeFileRangeIsNotCompressed(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"digits.txt": "0123456789"})
+	router := Create()
+	router.Use(CompressWith(CompressionPolicy{}))
+
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, filepath.Join(dir, protocol.RouteParams["filename"]))
+	})
+
+	response := doRequest(t, &router, "GET /files/digits.txt HTTP/1.1\r\nAccept-Encoding: gzip\r\nRange: bytes=2-5\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "2345", readBody(t, response))
+}
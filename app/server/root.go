@@ -0,0 +1,229 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrPathEscapesRoot = ServerError{"path escapes the root."}
+	ErrSymlinkRefused  = ServerError{"symlink refused."}
+)
+
+// Root opens files under a directory and nowhere else. Names are slash
+// separated and relative to the root, as in fs.FS, and names that are
+// absolute, contain .. elements or backslashes are rejected. Symlinks are
+// refused unless FollowSymlinks is set, and then only followed while their
+// target stays under the root.
+//
+// The checks happen before the file is opened, so they do not protect from
+// someone with write access to the directory swapping a component for a
+// symlink in between.
+type Root struct {
+	FollowSymlinks bool
+	dir            string
+}
+
+func NewRoot(dir string) *Root {
+	return &Root{dir: dir}
+}
+
+func (root *Root) Open(name string) (fs.File, error) {
+	filePath, err := root.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(filePath)
+}
+
+func (root *Root) Stat(name string) (fs.FileInfo, error) {
+	filePath, err := root.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Stat(filePath)
+}
+
+// Create creates or truncates the named file. Its parent directory must
+// already exist.
+func (root *Root) Create(name string) (*os.File, error) {
+	return root.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens the named file with flag and perm, as os.OpenFile does.
+func (root *Root) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	filePath, err := root.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(filePath, flag, perm)
+}
+
+// WriteFile writes content to the named file atomically: it is written to a
+// temporary file in the same directory, synced and then renamed into place,
+// so readers see either the previous file or the whole new one. Unless
+// overwrite is set, an existing file is left as it is and an error wrapping
+// fs.ErrExist is returned.
+func (root *Root) WriteFile(name string, content io.Reader, overwrite bool) error {
+	if name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	filePath, err := root.resolve("write", name)
+	if err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(filePath)
+	temp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, content); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(0o644); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if overwrite {
+		err = os.Rename(temp.Name(), filePath)
+	} else {
+		err = linkNew(temp.Name(), filePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// linkNew moves the file at oldPath to newPath unless newPath exists. A hard
+// link fails atomically when it does, and a rename after a check is the
+// fallback on filesystems without them.
+func linkNew(oldPath, newPath string) error {
+	err := os.Link(oldPath, newPath)
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	if _, err := os.Lstat(newPath); err == nil {
+		return &fs.PathError{Op: "link", Path: newPath, Err: fs.ErrExist}
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+// syncDir makes a rename in dir durable. Directories cannot be synced on
+// every platform, so it is done on a best effort basis.
+func syncDir(dir string) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	file.Sync()
+}
+
+// Remove removes the named file or empty directory. The root itself cannot
+// be removed.
+func (root *Root) Remove(name string) error {
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	filePath, err := root.resolve("remove", name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filePath)
+}
+
+// resolve returns the path on disk of name, checking every element of it. The
+// last element does not have to exist.
+func (root *Root) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrPathEscapesRoot}
+	}
+
+	base, err := filepath.Abs(root.dir)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if base, err = filepath.EvalSymlinks(base); err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	if name == "." {
+		return base, nil
+	}
+
+	current := base
+	elements := strings.Split(name, "/")
+
+	for idx, element := range elements {
+		next := filepath.Join(current, element)
+
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) && idx == len(elements)-1 {
+			return next, nil
+		} else if err != nil {
+			return "", &fs.PathError{Op: op, Path: name, Err: pathErrorCause(err)}
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if !root.FollowSymlinks {
+				return "", &fs.PathError{Op: op, Path: name, Err: ErrSymlinkRefused}
+			}
+
+			target, err := filepath.EvalSymlinks(next)
+			if err != nil {
+				return "", &fs.PathError{Op: op, Path: name, Err: pathErrorCause(err)}
+			}
+			if !isWithin(base, target) {
+				return "", &fs.PathError{Op: op, Path: name, Err: ErrPathEscapesRoot}
+			}
+			next = target
+		}
+
+		current = next
+	}
+
+	return current, nil
+}
+
+func isWithin(base, target string) bool {
+	rel, err := filepath.Rel(base, target)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+func pathErrorCause(err error) error {
+	var pathError *fs.PathError
+	if errors.As(err, &pathError) {
+		return pathError.Err
+	}
+
+	return err
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRootRejectsEscapes(t *testing.T) {
+	outside := writeFiles(t, map[string]string{"secret.txt": "secret"})
+	dir := writeFiles(t, map[string]string{"public/a.txt": "public"})
+	root := NewRoot(filepath.Join(dir, "public"))
+
+	names := []string{
+		"../secret.txt",
+		"a/../../secret.txt",
+		"..",
+		"/etc/passwd",
+		filepath.Join(outside, "secret.txt"),
+		`..\secret.txt`,
+		"./a.txt",
+		"a.txt/",
+		"",
+	}
+
+	for _, name := range names {
+		_, err := root.Open(name)
+		assert.True(t, errors.Is(err, ErrPathEscapesRoot), name)
+
+		_, err = root.Create(name)
+		assert.True(t, errors.Is(err, ErrPathEscapesRoot), name)
+	}
+
+	file, err := root.Open("a.txt")
+	assert.Nil(t, err)
+	content, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, "public", string(content))
+}
+
+func TestRootSymlinks(t *testing.T) {
+	outside := writeFiles(t, map[string]string{"secret.txt": "secret"})
+	dir := writeFiles(t, map[string]string{"real/a.txt": "a"})
+
+	assert.Nil(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "escape.txt")))
+	assert.Nil(t, os.Symlink(outside, filepath.Join(dir, "escape")))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "alias")))
+
+	root := NewRoot(dir)
+
+	for _, name := range []string{"escape.txt", "escape/secret.txt", "alias/a.txt"} {
+		_, err := root.Open(name)
+		assert.True(t, errors.Is(err, ErrSymlinkRefused), name)
+	}
+
+	root.FollowSymlinks = true
+
+	for _, name := range []string{"escape.txt", "escape/secret.txt"} {
+		_, err := root.Open(name)
+		assert.True(t, errors.Is(err, ErrPathEscapesRoot), name)
+	}
+
+	_, err := root.Create("escape/new.txt")
+	assert.True(t, errors.Is(err, ErrPathEscapesRoot))
+
+	file, err := root.Open("alias/a.txt")
+	assert.Nil(t, err)
+	file.Close()
+}
+
+func TestRootFollowsSymlinkedRootDirectory(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"real/a.txt": "a"})
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "link")))
+
+	file, err := NewRoot(filepath.Join(dir, "link")).Open("a.txt")
+	assert.Nil(t, err)
+	file.Close()
+}
+
+func TestRootFS(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "a", "nested/b.txt": "b"})
+
+	assert.Nil(t, fstest.TestFS(NewRoot(dir), "a.txt", "nested/b.txt"))
+
+	_, err := fs.Stat(NewRoot(dir), "missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestStaticRejectsTraversal(t *testing.T) {
+	outside := writeFiles(t, map[string]string{"secret.txt": "secret"})
+	dir := filepath.Join(outside, "public")
+	assert.Nil(t, os.Mkdir(dir, 0o755))
+	assert.Nil(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "link.txt")))
+
+	router := Create()
+	router.Static("/static", dir)
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFS(response, protocol, NewRoot(dir), protocol.RouteParams["filename"])
+	})
+
+	requests := []string{
+		"GET /static/../secret.txt HTTP/1.1\r\n\r\n",
+		"GET /static/%2e%2e/secret.txt HTTP/1.1\r\n\r\n",
+		"GET /static/%2e%2e%2fsecret.txt HTTP/1.1\r\n\r\n",
+		"GET /static/a/..%2f..%2f..%2fsecret.txt HTTP/1.1\r\n\r\n",
+		"GET /static/link.txt HTTP/1.1\r\n\r\n",
+		"GET /files/.. HTTP/1.1\r\n\r\n",
+		"GET /files/..%2fsecret.txt HTTP/1.1\r\n\r\n",
+		"GET /files/%2fetc%2fpasswd HTTP/1.1\r\n\r\n",
+		"GET /files/link.txt HTTP/1.1\r\n\r\n",
+	}
+
+	for _, request := range requests {
+		response := doRequest(t, &router, request)
+
+		assert.Equal(t, 404, response.StatusCode, request)
+		assert.NotEqual(t, "secret", readBody(t, response), request)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestRootWriteFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "old"})
+	root := NewRoot(dir)
+
+	assert.Nil(t, root.WriteFile("b.txt", strings.NewReader("new"), false))
+	content, _ := os.ReadFile(filepath.Join(dir, "b.txt"))
+	assert.Equal(t, "new", string(content))
+
+	err := root.WriteFile("a.txt", strings.NewReader("replaced"), false)
+	assert.True(t, errors.Is(err, fs.ErrExist))
+	content, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "old", string(content))
+
+	assert.Nil(t, root.WriteFile("a.txt", strings.NewReader("replaced"), true))
+	content, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "replaced", string(content))
+
+	// A failed write leaves the file as it was.
+	assert.NotNil(t, root.WriteFile("a.txt", io.MultiReader(strings.NewReader("partial"), failingReader{}), true))
+	content, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "replaced", string(content))
+
+	err = root.WriteFile("../escape.txt", strings.NewReader("x"), true)
+	assert.True(t, errors.Is(err, ErrPathEscapesRoot))
+
+	// The root itself is not a file, and nothing is written beside it.
+	parent := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(parent, "root"), 0o755))
+	err = NewRoot(filepath.Join(parent, "root")).WriteFile(".", strings.NewReader("x"), true)
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+	siblings, _ := os.ReadDir(parent)
+	assert.Len(t, siblings, 1)
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
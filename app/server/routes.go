@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Pattern     string   `json:"pattern"`
+	Name        string   `json:"name,omitempty"`
+	Middlewares []string `json:"middlewares"`
+}
+
+// Routes lists the registered routes in registration order. The routes of a
+// mounted router are listed in place of the mount, with the mount prefix.
+// Middlewares are listed in the order they run, global ones first.
+func (router *Router) Routes() []RouteInfo {
+	return router.routeInfos("", nil)
+}
+
+func (router *Router) routeInfos(prefix string, parentMiddlewares []string) []RouteInfo {
+	infos := []RouteInfo{}
+
+	router.walk(prefix, nil, parentMiddlewares, func(pattern string, constraints []*constraint, route *Route, middlewares []string) {
+		infos = append(infos, RouteInfo{
+			Method:      route.method,
+			Pattern:     pattern,
+			Name:        route.name,
+			Middlewares: middlewares,
+		})
+	})
+
+	return infos
+}
+
+// walk visits the routes in registration order, expanding mounted routers in
+// place, with the full pattern, the constraints of its params, in order, and
+// the names of the middlewares it runs.
+func (router *Router) walk(prefix string, parentConstraints []*constraint, parentMiddlewares []string, visit func(pattern string, constraints []*constraint, route *Route, middlewares []string)) {
+	middlewares := append(append([]string{}, parentMiddlewares...), middlewareNames(router.middlewares)...)
+	expanded := map[*Router]bool{}
+
+	for _, route := range router.routes {
+		if route.mounted != nil {
+			if !expanded[route.mounted] {
+				expanded[route.mounted] = true
+				mountPrefix := joinPaths(prefix, strings.TrimSuffix(route.path, string(WILDCARD_CHAR)))
+				mountConstraints := route.constraints
+				if strings.HasSuffix(route.path, string(WILDCARD_CHAR)) {
+					mountConstraints = mountConstraints[:len(mountConstraints)-1]
+				}
+				route.mounted.walk(mountPrefix, append(append([]*constraint{}, parentConstraints...), mountConstraints...), middlewares, visit)
+			}
+			continue
+		}
+
+		pattern := route.path
+		if prefix != "" {
+			pattern = joinPaths(prefix, route.path)
+		}
+
+		visit(pattern, append(append([]*constraint{}, parentConstraints...), route.constraints...), route, append(append([]string{}, middlewares...), middlewareNames(route.middlewares)...))
+	}
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+func middlewareNames(middlewares []Middleware) []string {
+	names := []string{}
+
+	for _, middleware := range middlewares {
+		name := runtime.FuncForPC(reflect.ValueOf(middleware).Pointer()).Name()
+		name = closureSuffix.ReplaceAllString(name, "")
+		names = append(names, name[strings.LastIndex(name, "/")+1:])
+	}
+
+	return names
+}
+
+// RoutesHandler renders the route table of router, as JSON when the client
+// accepts application/json and as a plain text table otherwise.
+func RoutesHandler(router *Router) RouteHandler {
+	return func(protocol *HTTPProtocol, response *HTTPResponse) {
+		routes := router.Routes()
+
+		if slices.Contains(protocol.Headers["Accept"], "application/json") {
+			body, err := json.Marshal(routes)
+			if err != nil {
+				response.StatusCode(HttpStatus.InternalSeverError)
+				response.Body(err.Error())
+				response.Send()
+				return
+			}
+
+			response.SetHeader("Content-Type", "application/json")
+			response.Body(string(body))
+			response.Send()
+			return
+		}
+
+		var builder strings.Builder
+		writer := tabwriter.NewWriter(&builder, 0, 4, 2, ' ', 0)
+
+		fmt.Fprintln(writer, "METHOD\tPATTERN\tNAME\tMIDDLEWARES")
+		for _, route := range routes {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", route.Method, route.Pattern, route.Name, strings.Join(route.Middlewares, ", "))
+		}
+		writer.Flush()
+
+		response.SetHeader("Content-Type", "text/plain")
+		response.Body(builder.String())
+		response.Send()
+	}
+}
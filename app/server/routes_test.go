@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes(t *testing.T) {
+	calls := []string{}
+	admin := Create()
+	admin.Use(recordingMiddleware("admin", &calls))
+	admin.Get("/users", noopHandler).Name("admin-users")
+
+	router := Create()
+	router.Use(Compress())
+	router.Get("/files/[filename]", noopHandler, recordingMiddleware("route", &calls)).Name("file")
+	router.Mount("/admin", &admin)
+	router.Post("/files/[filename]", noopHandler)
+
+	assert.Equal(t, []RouteInfo{
+		{"GET", "/files/[filename]", "file", []string{"server.CompressWith", "server.recordingMiddleware"}},
+		{"GET", "/admin/users", "admin-users", []string{"server.CompressWith", "server.recordingMiddleware"}},
+		{"POST", "/files/[filename]", "", []string{"server.CompressWith"}},
+	}, router.Routes())
+}
+
+func TestRoutesHandler(t *testing.T) {
+	client, server := net.Pipe()
+	router := Create()
+
+	defer client.Close()
+	defer server.Close()
+
+	router.Get("/debug/routes", RoutesHandler(&router)).Name("routes")
+
+	go client.Write([]byte("GET /debug/routes HTTP/1.1\r\nAccept: application/json\r\n\r\n"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", response.Headers["Content-Type"])
+
+	routes := []RouteInfo{}
+	assert.Nil(t, json.Unmarshal([]byte(response.Body), &routes))
+	assert.Equal(t, []RouteInfo{{"GET", "/debug/routes", "routes", []string{}}}, routes)
+}
@@ -0,0 +1,478 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	S3_SERVICE        = "s3"
+	SIGV4_ALGORITHM   = "AWS4-HMAC-SHA256"
+	SIGV4_TIME_FORMAT = "20060102T150405Z"
+
+	S3_DEFAULT_TIMEOUT = 30 * time.Second
+)
+
+// defaultS3Client is used by an S3Storage without a Client.
+var defaultS3Client = &http.Client{Timeout: S3_DEFAULT_TIMEOUT}
+
+// S3Storage keeps files as the objects of a bucket of an S3 compatible
+// service. Objects are addressed path style, as Endpoint/Bucket/name, and
+// requests are signed with AWS Signature Version 4.
+//
+// Storage methods take no context, so a request goes on when the client it
+// serves goes away. A nil Client uses one with a timeout of
+// S3_DEFAULT_TIMEOUT, which bounds each request to the service including the
+// read of its body: files read for longer than that through Open, such as
+// slow downloads of large objects, need a Client with a longer timeout.
+//
+// Directories are the common prefixes of object names, as listed with a /
+// delimiter. Create without overwrite relies on conditional writes, with
+// If-None-Match: *, which the service must support.
+type S3Storage struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// S3Error is an error response of the service.
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (error S3Error) Error() string {
+	return fmt.Sprintf("Server error: s3 %d %s: %s", error.StatusCode, error.Code, error.Message)
+}
+
+// s3Object is an open object. It is read with ranged GET requests, so that
+// seeking does not download what it skips, and only while the object still
+// has the entity tag it was opened with.
+type s3Object struct {
+	storage *S3Storage
+	name    string
+	info    fileInfo
+	offset  int64
+	body    io.ReadCloser
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+		ETag         string
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (storage *S3Storage) Open(name string) (fs.File, error) {
+	if err := validStorageName("open", name); err != nil {
+		return nil, err
+	}
+
+	info, err := storage.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Object{storage: storage, name: name, info: info}, nil
+}
+
+func (storage *S3Storage) Create(name string, content io.Reader, overwrite bool) error {
+	if err := validStorageName("create", name); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+	if !overwrite {
+		headers.Set("If-None-Match", "*")
+	}
+
+	response, err := storage.do("PUT", name, nil, headers, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+	default:
+		return readS3Error(response)
+	}
+}
+
+func (storage *S3Storage) Stat(name string) (fs.FileInfo, error) {
+	if err := validStorageName("stat", name); err != nil {
+		return nil, err
+	}
+
+	info, err := storage.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// stat returns the info of the named object, or of the directory of that
+// name.
+func (storage *S3Storage) stat(op, name string) (fileInfo, error) {
+	if name == "." {
+		return fileInfo{name: ".", dir: true}, nil
+	}
+
+	response, err := storage.do("HEAD", name, nil, nil, nil)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+		return fileInfo{
+			name:    path.Base(name),
+			size:    response.ContentLength,
+			modTime: modTime,
+			etag:    response.Header.Get("ETag"),
+		}, nil
+	}
+	// HEAD responses have no body, so there is no error code to read.
+	if response.StatusCode != http.StatusNotFound {
+		return fileInfo{}, S3Error{StatusCode: response.StatusCode}
+	}
+
+	result, err := storage.list(dirPrefix(name), "", 1)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	if len(result.Contents) == 0 && len(result.CommonPrefixes) == 0 {
+		return fileInfo{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return fileInfo{name: path.Base(name), dir: true}, nil
+}
+
+func (storage *S3Storage) Delete(name string) error {
+	if err := validStorageName("delete", name); err != nil {
+		return err
+	}
+
+	info, err := storage.stat("delete", name)
+	if err != nil {
+		return err
+	}
+	if info.dir {
+		return &fs.PathError{Op: "delete", Path: name, Err: fs.ErrInvalid}
+	}
+
+	response, err := storage.do("DELETE", name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return readS3Error(response)
+	}
+
+	return nil
+}
+
+func (storage *S3Storage) List(dir string) ([]fs.FileInfo, error) {
+	if err := validStorageName("list", dir); err != nil {
+		return nil, err
+	}
+
+	prefix := dirPrefix(dir)
+	infos := []fs.FileInfo{}
+
+	for token := ""; ; {
+		result, err := storage.list(prefix, token, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			// Keys ending with a slash are directory markers, not files.
+			if name := strings.TrimPrefix(object.Key, prefix); name != "" && !strings.HasSuffix(name, "/") {
+				infos = append(infos, fileInfo{name: name, size: object.Size, modTime: object.LastModified, etag: object.ETag})
+			}
+		}
+		for _, common := range result.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(common.Prefix, prefix), "/")
+			infos = append(infos, fileInfo{name: name, dir: true})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	if dir != "." && len(infos) == 0 {
+		return nil, &fs.PathError{Op: "list", Path: dir, Err: fs.ErrNotExist}
+	}
+
+	return infos, nil
+}
+
+// list runs a ListObjectsV2 request for the objects directly under prefix.
+// A zero maxKeys leaves the page size to the service.
+func (storage *S3Storage) list(prefix, token string, maxKeys int) (*listBucketResult, error) {
+	query := url.Values{"list-type": {"2"}, "delimiter": {"/"}, "prefix": {prefix}}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	if maxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(maxKeys))
+	}
+
+	response, err := storage.do("GET", "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, readS3Error(response)
+	}
+
+	result := &listBucketResult{}
+	if err := xml.NewDecoder(response.Body).Decode(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// do sends a signed request for the object name, or for the bucket when name
+// is empty.
+func (storage *S3Storage) do(method, name string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	target := strings.TrimSuffix(storage.Endpoint, "/") + "/" + uriEncode(storage.Bucket, false)
+	if name != "" {
+		target += "/" + uriEncode(name, true)
+	}
+	if len(query) > 0 {
+		target += "?" + canonicalQuery(query)
+	}
+
+	request, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range headers {
+		request.Header[key] = values
+	}
+
+	sum := sha256.Sum256(body)
+	signV4(request, hex.EncodeToString(sum[:]), storage.AccessKey, storage.SecretKey, storage.Region, time.Now())
+
+	client := storage.Client
+	if client == nil {
+		client = defaultS3Client
+	}
+
+	return client.Do(request)
+}
+
+func readS3Error(response *http.Response) error {
+	s3Error := S3Error{StatusCode: response.StatusCode}
+
+	var body struct {
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(response.Body).Decode(&body); err == nil {
+		s3Error.Code = body.Code
+		s3Error.Message = body.Message
+	}
+
+	return s3Error
+}
+
+func (object *s3Object) Stat() (fs.FileInfo, error) {
+	return object.info, nil
+}
+
+func (object *s3Object) Read(b []byte) (int, error) {
+	if object.info.dir || object.offset >= object.info.size {
+		return 0, io.EOF
+	}
+
+	if object.body == nil {
+		headers := http.Header{"If-Match": {object.info.etag}}
+		if object.offset > 0 {
+			headers.Set("Range", fmt.Sprintf("bytes=%d-", object.offset))
+		}
+
+		response, err := object.storage.do("GET", object.name, nil, headers, nil)
+		if err != nil {
+			return 0, err
+		}
+		if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+			defer response.Body.Close()
+			return 0, readS3Error(response)
+		}
+		object.body = response.Body
+	}
+
+	n, err := object.body.Read(b)
+	object.offset += int64(n)
+
+	return n, err
+}
+
+func (object *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += object.offset
+	case io.SeekEnd:
+		offset += object.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: object.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != object.offset {
+		object.Close()
+		object.offset = offset
+	}
+
+	return offset, nil
+}
+
+func (object *s3Object) Close() error {
+	if object.body == nil {
+		return nil
+	}
+
+	err := object.body.Close()
+	object.body = nil
+	return err
+}
+
+// signV4 signs request with AWS Signature Version 4, signing the host and
+// every header set on request so far.
+func signV4(request *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	date := now.UTC().Format(SIGV4_TIME_FORMAT)
+	request.Header.Set("X-Amz-Date", date)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host"}
+	for key := range request.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(key))
+	}
+	slices.Sort(signedHeaders)
+
+	scope := strings.Join([]string{date[:8], region, S3_SERVICE, "aws4_request"}, "/")
+	signature := sigV4Signature(request, signedHeaders, payloadHash, secretKey, region, date)
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		SIGV4_ALGORITHM, accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// sigV4Signature computes the signature of request over signedHeaders, which
+// must be lower case and sorted, at date, in SIGV4_TIME_FORMAT.
+func sigV4Signature(request *http.Request, signedHeaders []string, payloadHash, secretKey, region, date string) string {
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+
+	var headers strings.Builder
+	for _, key := range signedHeaders {
+		value := host
+		if key != "host" {
+			value = strings.Join(strings.Fields(strings.Join(request.Header.Values(key), ",")), " ")
+		}
+		headers.WriteString(key + ":" + value + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date[:8], region, S3_SERVICE, "aws4_request"}, "/")
+	canonicalSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{SIGV4_ALGORITHM, date, scope, hex.EncodeToString(canonicalSum[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date[:8])
+	for _, part := range []string{region, S3_SERVICE, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes the query as signing requires.
+func canonicalQuery(query url.Values) string {
+	pairs := []string{}
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, false)+"="+uriEncode(value, false))
+		}
+	}
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and
+// slashes when keepSlash is set.
+func uriEncode(value string, keepSlash bool) string {
+	var builder strings.Builder
+
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '.', b == '_', b == '~', b == '/' && keepSlash:
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+
+	return builder.String()
+}
@@ -1,51 +1,97 @@
 package server
 
 import (
-	"bytes"
-	"compress/gzip"
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"maps"
 	"net"
+	"net/http"
+	"net/url"
 	"regexp"
-	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type HTTPProtocol struct {
 	version     string
 	method      string
 	Path        string
+	Query       url.Values
 	Headers     map[string][]string
 	RouteParams map[string]string
 	Body        string
+	rawQuery    string
+	remoteAddr  string
+	maxBodySize int64
+	ctx         context.Context
 }
 
 type HTTPStatusCode struct {
-	Ok                 int
-	Created            int
-	NotFound           int
-	InternalSeverError int
+	Ok                   int
+	Created              int
+	NoContent            int
+	PartialContent       int
+	MovedPermanently     int
+	NotModified          int
+	BadRequest           int
+	Forbidden            int
+	NotFound             int
+	NotAcceptable        int
+	Conflict             int
+	PreconditionFailed   int
+	PayloadTooLarge      int
+	UnsupportedMediaType int
+	RangeNotSatisfiable  int
+	InternalSeverError   int
 }
 
 type HTTPResponse struct {
-	conn          net.Conn
+	writer        responseWriter
 	statusCode    int
-	customHeaders map[string]string
+	customHeaders map[string][]string
 	body          string
 	headerSent    bool
 	sent          bool
+	encoding      string
+	compressor    *compressor
+	encoder       encoder
+	pending       []byte
 }
 
 type RouteHandler func(protocol *HTTPProtocol, response *HTTPResponse)
 
+type Middleware func(next RouteHandler) RouteHandler
+
 type Route struct {
-	path    string
-	handler RouteHandler
+	method      string
+	path        string
+	name        string
+	handler     RouteHandler
+	middlewares []Middleware
+	paramNames  []string
+	constraints []*constraint
+	mounted     *Router
+	docs        routeDocs
 }
 
 type Router struct {
-	getRoutes  []Route
-	postRoutes []Route
+	trees       map[string]*node
+	routes      []*Route
+	mounts      []mount
+	middlewares []Middleware
+	strict      bool
+	conflicts   []error
+	timeout     time.Duration
+	maxBodySize int64
+	mutex       sync.Mutex
+	listener    net.Listener
+	closed      bool
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 type ServerError struct {
@@ -56,13 +102,28 @@ const (
 	OPEN_PLACEHOLDER_CHAR  = '['
 	CLOSE_PLACEHOLDER_CHAR = ']'
 	WILDCARD_CHAR          = '*'
+	DEFAULT_MAX_BODY_SIZE  = 10 << 20
 )
 
+var errRequestBodyTooLarge = ServerError{"request body too large."}
+
 var HttpStatus = HTTPStatusCode{
-	Ok:                 200,
-	Created:            201,
-	NotFound:           404,
-	InternalSeverError: 500,
+	Ok:                   200,
+	Created:              201,
+	NoContent:            204,
+	PartialContent:       206,
+	MovedPermanently:     301,
+	NotModified:          304,
+	BadRequest:           400,
+	Forbidden:            403,
+	NotFound:             404,
+	NotAcceptable:        406,
+	Conflict:             409,
+	PreconditionFailed:   412,
+	PayloadTooLarge:      413,
+	UnsupportedMediaType: 415,
+	RangeNotSatisfiable:  416,
+	InternalSeverError:   500,
 }
 
 func Create() Router {
@@ -73,30 +134,77 @@ func (error ServerError) Error() string {
 	return fmt.Sprintf("Server error: %s", error.message)
 }
 
-func (router *Router) Get(path string, handler RouteHandler) {
-	router.getRoutes = append(router.getRoutes, Route{path, handler})
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
 }
 
-func (router *Router) Post(path string, handler RouteHandler) {
-	router.postRoutes = append(router.postRoutes, Route{path, handler})
+// MaxBodySize limits the length of request bodies. Requests with a longer
+// Content-Length are answered with 413 Payload Too Large, without reading
+// their body. A size of zero or less uses DEFAULT_MAX_BODY_SIZE.
+func (router *Router) MaxBodySize(size int64) {
+	router.maxBodySize = size
 }
 
-func resolveConnection(conn net.Conn) (*HTTPProtocol, error) {
-	buffer := make([]byte, 1024)
+func (router *Router) bodyLimit() int64 {
+	if router.maxBodySize <= 0 {
+		return DEFAULT_MAX_BODY_SIZE
+	}
 
-	n, err := conn.Read(buffer)
-	if err != nil {
-		return nil, ServerError{"unexpected error."}
+	return router.maxBodySize
+}
+
+func (router *Router) Get(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return router.handle("GET", path, handler, middlewares)
+}
+
+func (router *Router) Post(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return router.handle("POST", path, handler, middlewares)
+}
+
+func (router *Router) Put(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return router.handle("PUT", path, handler, middlewares)
+}
+
+func (router *Router) Delete(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return router.handle("DELETE", path, handler, middlewares)
+}
+
+// Head registers a HEAD route. HEAD requests without one are answered by
+// the GET route of the path, and their body is never sent.
+func (router *Router) Head(path string, handler RouteHandler, middlewares ...Middleware) *Route {
+	return router.handle("HEAD", path, handler, middlewares)
+}
+
+func (router *Router) handle(method, path string, handler RouteHandler, middlewares []Middleware) *Route {
+	if router.trees == nil {
+		router.trees = make(map[string]*node)
+	}
+	if _, ok := router.trees[method]; !ok {
+		router.trees[method] = &node{}
 	}
-	buffer = buffer[:n]
 
-	request := string(buffer)
-	parts := strings.Split(request, "\r\n")
-	if len(parts) == 0 {
-		return nil, ServerError{"malformated request."}
+	route := &Route{method: method, path: path, handler: handler, middlewares: middlewares}
+	if existing := router.trees[method].insert(route); existing != nil {
+		conflict := newRouteConflictError(route, existing)
+		if router.strict {
+			panic(conflict)
+		}
+
+		router.conflicts = append(router.conflicts, conflict)
+		return route
+	}
+
+	router.routes = append(router.routes, route)
+	return route
+}
+
+func resolveConnection(reader *bufio.Reader, maxBodySize int64) (*HTTPProtocol, error) {
+	requestLine, err := readLine(reader)
+	if err != nil {
+		return nil, ServerError{"unexpected error."}
 	}
 
-	target := strings.Split(parts[0], " ")
+	target := strings.Split(requestLine, " ")
 	if len(target) != 3 {
 		return nil, ServerError{"malformated request."}
 	}
@@ -107,83 +215,153 @@ func resolveConnection(conn net.Conn) (*HTTPProtocol, error) {
 
 	// Read HTTP target
 	protocol.method = target[0]
-	protocol.Path = target[1]
+	protocol.Path, protocol.rawQuery, _ = strings.Cut(target[1], "?")
+	protocol.Query, _ = url.ParseQuery(protocol.rawQuery)
 	protocol.version = target[2]
 
 	// Read HTTP headers
-	idx := 1
-	for ; idx < len(parts) && parts[idx] != ""; idx++ {
-		header := strings.Split(parts[idx], ": ")
-
-		if len(header) != 2 {
+	for {
+		line, err := readLine(reader)
+		if err != nil {
 			return nil, ServerError{"malformated request."}
 		}
+		if line == "" {
+			break
+		}
 
-		protocol.Headers[header[0]] = strings.Split(header[1], ", ")
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			return nil, ServerError{"malformated request."}
+		}
 
+		protocol.Headers[key] = strings.Split(value, ", ")
 	}
 
 	// Read possible body
-	if idx+1 < len(parts) {
-		protocol.Body = parts[idx+1]
-	} else {
-		protocol.Body = ""
+	if contentLength, ok := protocol.Headers["Content-Length"]; ok {
+		length, err := strconv.ParseInt(contentLength[0], 10, 64)
+		if err != nil || length < 0 {
+			return nil, ServerError{"malformated request."}
+		}
+		if length > maxBodySize {
+			return nil, errRequestBodyTooLarge
+		}
+
+		body, err := io.ReadAll(io.LimitReader(reader, length))
+		if err != nil || int64(len(body)) < length {
+			return nil, ServerError{"malformated request."}
+		}
+		protocol.Body = string(body)
 	}
 
 	return &protocol, nil
 }
 
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
 func (router *Router) Listen(address string) error {
+	if err := router.Err(); err != nil {
+		return err
+	}
+
 	listener, err := net.Listen("tcp", address)
 
 	if err != nil {
 		return err
 	}
 
+	router.mutex.Lock()
+	if router.closed {
+		router.mutex.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	router.listener = listener
+	router.mutex.Unlock()
+
 	for {
-		conn, _ := listener.Accept()
+		conn, err := listener.Accept()
+		if err != nil {
+			if router.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
 		go router.connectionHandler(conn)
 	}
 }
 
 func (router *Router) connectionHandler(conn net.Conn) error {
-	protocol, err := resolveConnection(conn)
+	reader := bufio.NewReader(conn)
+	protocol, err := resolveConnection(reader, router.bodyLimit())
 
+	if err == errRequestBodyTooLarge {
+		response := &HTTPResponse{writer: connWriter{conn}, customHeaders: make(map[string][]string)}
+		response.StatusCode(HttpStatus.PayloadTooLarge)
+		response.Send()
+	}
 	if err != nil {
 		conn.Close()
 		return err
 	}
 
-	response := &HTTPResponse{conn: conn, customHeaders: make(map[string]string)}
+	ctx, cancel := router.requestContext()
+	defer cancel()
+
+	protocol.ctx = ctx
+	protocol.remoteAddr = conn.RemoteAddr().String()
+	protocol.maxBodySize = router.bodyLimit()
+	go watchDisconnect(reader, cancel)
+
+	response := &HTTPResponse{writer: connWriter{conn}, customHeaders: make(map[string][]string)}
+	if protocol.method == "HEAD" {
+		response.writer = headWriter{response.writer}
+	}
 
 	defer response.Close()
 
-	if _, ok := protocol.Headers["Accept-Encoding"]; ok {
-		if slices.Contains(protocol.Headers["Accept-Encoding"], "gzip") {
-			response.SetHeader("Content-Encoding", "gzip")
-		}
+	router.serve(protocol, response)
+
+	return nil
+}
+
+func (router *Router) serve(protocol *HTTPProtocol, response *HTTPResponse) {
+	handler := chain(router.resolve(protocol), router.middlewares)
+	handler(protocol, response)
+}
+
+func (router *Router) resolve(protocol *HTTPProtocol) RouteHandler {
+	route, params := router.lookup(protocol.method, protocol.Path)
+	if route == nil && protocol.method == "HEAD" {
+		route, params = router.lookup("GET", protocol.Path)
+	}
+	if route == nil {
+		return notFoundHandler
 	}
 
-	if protocol.method == "GET" {
-		for _, route := range router.getRoutes {
-			if pathMatch(protocol.Path, route.path) {
-				protocol.RouteParams = getRouteParams(protocol.Path, route.path)
-				route.handler(protocol, response)
-				return nil
-			}
-		}
-	} else if protocol.method == "POST" {
-		for _, route := range router.postRoutes {
-			if pathMatch(protocol.Path, route.path) {
-				protocol.RouteParams = getRouteParams(protocol.Path, route.path)
-				route.handler(protocol, response)
-				return nil
-			}
-		}
+	protocol.RouteParams = params
+	return chain(route.handler, route.middlewares)
+}
+
+func (router *Router) lookup(method, path string) (*Route, map[string]string) {
+	tree, ok := router.trees[method]
+	if !ok {
+		return nil, nil
 	}
 
-	response.StatusCode(404)
-	return nil
+	return tree.lookup(path)
+}
+
+func notFoundHandler(protocol *HTTPProtocol, response *HTTPResponse) {
+	response.StatusCode(HttpStatus.NotFound)
 }
 
 func isPlaceholder(segment string) bool {
@@ -192,6 +370,19 @@ func isPlaceholder(segment string) bool {
 		segment[len(segment)-1] == CLOSE_PLACEHOLDER_CHAR
 }
 
+func isCatchAll(segment string) bool {
+	return segment == string(WILDCARD_CHAR) ||
+		(isPlaceholder(segment) && segment[1] == WILDCARD_CHAR)
+}
+
+func catchAllName(segment string) string {
+	if segment == string(WILDCARD_CHAR) {
+		return ""
+	}
+
+	return segment[2 : len(segment)-1]
+}
+
 func getPathSegments(path string) []string {
 	segments := []string{}
 
@@ -205,19 +396,11 @@ func getPathSegments(path string) []string {
 }
 
 func pathMatch(requestPath, routePath string) bool {
-	requestSegments := getPathSegments(requestPath)
-	routeSegments := getPathSegments(routePath)
-	idx := 0
-
-	for ; idx < len(requestSegments) && idx < len(routeSegments); idx++ {
-		if routeSegments[idx] == string(WILDCARD_CHAR) {
-			return true
-		} else if !isPlaceholder(routeSegments[idx]) && requestSegments[idx] != routeSegments[idx] {
-			return false
-		}
-	}
+	tree := &node{}
+	tree.insert(&Route{path: routePath})
 
-	return len(requestSegments) == len(routeSegments)
+	route, _ := tree.lookup(requestPath)
+	return route != nil
 }
 
 func stripPlaceholderChars(placeholder string) string {
@@ -229,34 +412,39 @@ func stripPlaceholderChars(placeholder string) string {
 }
 
 func getRouteParams(requestPath, routePath string) map[string]string {
-	routeParams := make(map[string]string)
-	requestSegments := getPathSegments(requestPath)
-	routeSegments := getPathSegments(routePath)
+	tree := &node{}
+	tree.insert(&Route{path: routePath})
 
-	if len(requestSegments) != len(routeSegments) {
-		return make(map[string]string)
-	}
+	_, params := tree.lookup(requestPath)
+	return params
+}
 
-	for idx := 0; idx < len(requestSegments); idx++ {
-		if isPlaceholder(routeSegments[idx]) {
-			routeParams[stripPlaceholderChars(routeSegments[idx])] = requestSegments[idx]
-		} else if routeSegments[idx] != requestSegments[idx] {
-			return make(map[string]string)
-		}
+func (response *HTTPResponse) SetHeader(key, value string) error {
+	if response.sent {
+		return ServerError{"connection already closed."}
 	}
 
-	return routeParams
+	response.customHeaders[key] = []string{value}
+	return nil
 }
 
-func (response *HTTPResponse) SetHeader(key, value string) error {
+func (response *HTTPResponse) AddHeader(key, value string) error {
 	if response.sent {
 		return ServerError{"connection already closed."}
 	}
 
-	response.customHeaders[key] = value
+	response.customHeaders[key] = append(response.customHeaders[key], value)
 	return nil
 }
 
+func (response *HTTPResponse) GetHeader(key string) string {
+	if values := response.customHeaders[key]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
 func (response *HTTPResponse) Body(body string) (*HTTPResponse, error) {
 	if response.sent {
 		return nil, ServerError{"connection already closed."}
@@ -275,6 +463,47 @@ func (response *HTTPResponse) StatusCode(statusCode int) (*HTTPResponse, error)
 	return response, nil
 }
 
+func (protocol *HTTPProtocol) Method() string {
+	return protocol.method
+}
+
+// responseWriter is where an HTTPResponse is written to: the connection, or a
+// net/http ResponseWriter when the router runs under net/http.
+type responseWriter interface {
+	writeHeader(statusCode int, headers map[string][]string) error
+	Write(b []byte) (int, error)
+	Close() error
+}
+
+type connWriter struct {
+	net.Conn
+}
+
+func (writer connWriter) writeHeader(statusCode int, headers map[string][]string) error {
+	var builder strings.Builder
+
+	builder.WriteString(statusCodeLine(statusCode))
+	for key, values := range headers {
+		for _, value := range values {
+			builder.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
+		}
+	}
+	builder.WriteString("\r\n")
+
+	_, err := writer.Write([]byte(builder.String()))
+	return err
+}
+
+// headWriter sends the header of a response to a HEAD request and drops its
+// body.
+type headWriter struct {
+	responseWriter
+}
+
+func (writer headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
 func statusCodeLine(statusCode int) string {
 	switch statusCode {
 	case HttpStatus.Ok:
@@ -285,8 +514,10 @@ func statusCodeLine(statusCode int) string {
 		return "HTTP/1.1 404 Not Found\r\n"
 	case HttpStatus.InternalSeverError:
 		return "HTTP/1.1 500 Internal Server Error\r\n"
-	default:
+	case 0:
 		return "HTTP/1.1 200 OK\r\n"
+	default:
+		return fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
 	}
 }
 
@@ -295,23 +526,15 @@ func (response *HTTPResponse) writeHeader(serverHeaders map[string]string) error
 		return ServerError{"header already sent."}
 	}
 
-	if _, err := response.conn.Write([]byte(statusCodeLine(response.statusCode))); err != nil {
-		return err
-	}
+	headers := maps.Clone(response.customHeaders)
 
 	for key, value := range serverHeaders {
-		if _, err := response.conn.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value))); err != nil {
-			return err
-		}
-	}
-
-	for key, value := range response.customHeaders {
-		if _, err := response.conn.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value))); err != nil {
-			return err
+		if _, ok := headers[key]; !ok {
+			headers[key] = []string{value}
 		}
 	}
 
-	if _, err := response.conn.Write([]byte("\r\n")); err != nil {
+	if err := response.writer.writeHeader(response.statusCode, headers); err != nil {
 		return err
 	}
 
@@ -325,12 +548,62 @@ func (response *HTTPResponse) Write(b []byte) (int, error) {
 	}
 
 	if !response.headerSent {
-		if err := response.writeHeader(map[string]string{}); err != nil {
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		// Small bodies are held back until it is known whether they reach
+		// the compression threshold.
+		if response.compressor != nil && response.compressor.waitsFor(response, len(response.pending)+len(b)) {
+			response.pending = append(response.pending, b...)
+			return len(b), nil
+		}
+
+		if err := response.startBody(len(response.pending) + len(b)); err != nil {
 			return 0, err
 		}
 	}
 
-	n, err := response.conn.Write(b)
+	return response.writeBody(b)
+}
+
+// startBody sends the header, compressing the body from now on when the
+// compression policy allows it. size is the length of the body, or -1 when
+// it is unknown.
+func (response *HTTPResponse) startBody(size int) error {
+	if contentLength, err := strconv.Atoi(response.GetHeader("Content-Length")); err == nil {
+		size = contentLength
+	}
+
+	// The length of the encoded stream is unknown, the end of the
+	// connection delimits it instead.
+	if response.compressor != nil && response.compressor.allows(response, response.GetHeader("Content-Type"), size) {
+		response.markEncoded()
+		delete(response.customHeaders, "Content-Length")
+		response.encoder = response.compressor.encoder(response.encoding, response.writer)
+	}
+
+	if err := response.writeHeader(map[string]string{}); err != nil {
+		return err
+	}
+
+	pending := response.pending
+	response.pending = nil
+
+	_, err := response.writeBody(pending)
+	return err
+}
+
+func (response *HTTPResponse) writeBody(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if response.encoder != nil {
+		return response.encoder.Write(b)
+	}
+
+	n, err := response.writer.Write(b)
 
 	if err != nil {
 		return n, err
@@ -339,6 +612,33 @@ func (response *HTTPResponse) Write(b []byte) (int, error) {
 	return n, nil
 }
 
+// Flush sends the header, if it was not sent yet, and anything buffered on
+// the way to the client.
+func (response *HTTPResponse) Flush() error {
+	if response.sent {
+		return ServerError{"connection already closed."}
+	}
+
+	// A flushed body is streamed, so its length is taken as unknown.
+	if !response.headerSent {
+		if err := response.startBody(-1); err != nil {
+			return err
+		}
+	}
+
+	if response.encoder != nil {
+		if err := response.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if flusher, ok := response.writer.(interface{ Flush() }); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
 func (response *HTTPResponse) Send() error {
 	if response.sent {
 		return ServerError{"connection already closed."}
@@ -354,32 +654,32 @@ func (response *HTTPResponse) Send() error {
 	var message []byte
 	var messageLength int
 
-	if response.customHeaders["Content-Encoding"] == "gzip" {
-		var buffer bytes.Buffer
-		gzipWriter := gzip.NewWriter(&buffer)
-
-		if _, err := gzipWriter.Write([]byte(response.body)); err != nil {
-			return err
-		}
+	contentType := response.GetHeader("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
 
-		if err := gzipWriter.Close(); err != nil {
+	if response.compressor != nil && response.compressor.allows(response, contentType, len(response.body)) {
+		encoded, err := response.compressor.encodeBody(response.encoding, []byte(response.body))
+		if err != nil {
 			return err
 		}
 
-		message = buffer.Bytes()
-		messageLength = buffer.Len()
+		response.markEncoded()
+		message = encoded
+		messageLength = len(encoded)
 	} else {
 		message = []byte(response.body)
 		messageLength = len(response.body)
 	}
 
-	serverHeaders["Content-Type"] = "plain/text"
+	serverHeaders["Content-Type"] = contentType
 	serverHeaders["Content-Length"] = strconv.Itoa(messageLength)
 
 	if err := response.writeHeader(serverHeaders); err != nil {
 		return err
 	}
-	if _, err := response.conn.Write(message); err != nil {
+	if _, err := response.writer.Write(message); err != nil {
 		return err
 	}
 
@@ -392,12 +692,16 @@ func (response *HTTPResponse) Close() error {
 	}
 
 	if !response.headerSent {
-		if err := response.writeHeader(map[string]string{}); err != nil {
+		if err := response.startBody(len(response.pending)); err != nil {
 			return err
 		}
 	}
 
-	response.conn.Close()
+	if response.encoder != nil {
+		response.encoder.Close()
+	}
+
+	response.writer.Close()
 	response.sent = true
 	return nil
 }
@@ -132,7 +132,7 @@ func TestResponseFormat(t *testing.T) {
 	assert.Equal(t, response.Version, "HTTP/1.1")
 	assert.Equal(t, response.StatusCode, 200)
 	assert.Equal(t, response.StatusCodeText, "OK")
-	assert.Equal(t, response.Headers["Content-Type"], "plain/text")
+	assert.Equal(t, response.Headers["Content-Type"], "text/plain")
 	assert.Equal(t, response.Headers["Content-Length"], "17")
 	assert.Equal(t, response.Body, "the response body")
 }
@@ -179,7 +179,7 @@ func TestCustomHeaders(t *testing.T) {
 	assert.Equal(t, response.Version, "HTTP/1.1")
 	assert.Equal(t, response.StatusCode, 200)
 	assert.Equal(t, response.StatusCodeText, "OK")
-	assert.Equal(t, response.Headers["Content-Type"], "plain/text")
+	assert.Equal(t, response.Headers["Content-Type"], "text/plain")
 	assert.Equal(t, response.Headers["Content-Length"], "23")
 	assert.Equal(t, response.Headers["Cache-Control"], "max-age=604800")
 	assert.Equal(t, response.Headers["Set-Cookie"], "key=value; HttpOnly")
@@ -247,6 +247,8 @@ func TestCompressedResponse(t *testing.T) {
 	defer client.Close()
 	defer server.Close()
 
+	router.Use(CompressWith(CompressionPolicy{}))
+
 	router.Get("/user", func(protocol *HTTPProtocol, response *HTTPResponse) {
 		response.Body("{\"email\": \"name@email.com\", \"password\": 123456}")
 		response.Send()
@@ -287,3 +289,40 @@ func TestNotFoundRouteResponse(t *testing.T) {
 	assert.Equal(t, response.StatusCode, 404)
 	assert.Equal(t, response.StatusCodeText, "Not Found")
 }
+
+func TestOversizedRequestBody(t *testing.T) {
+	router := Create()
+	router.MaxBodySize(8)
+
+	router.Post("/upload", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		response.Body(protocol.Body)
+		response.Send()
+	})
+
+	for _, request := range []string{
+		"POST /upload HTTP/1.1\r\nContent-Length: 9223372036854775807\r\n\r\nbody",
+		"POST /upload HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789",
+	} {
+		client, server := net.Pipe()
+
+		go client.Write([]byte(request))
+		go router.connectionHandler(server)
+
+		response, err := readHTTPResponse(client)
+		assert.Nil(t, err)
+		assert.Equal(t, 413, response.StatusCode)
+
+		client.Close()
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go client.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 8\r\n\r\n12345678"))
+	go router.connectionHandler(server)
+
+	response, err := readHTTPResponse(client)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "12345678", response.Body)
+}
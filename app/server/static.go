@@ -0,0 +1,356 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_INDEX_FILE  = "index.html"
+	GZIP_SIDECAR_SUFFIX = ".gz"
+)
+
+// FileServer serves the files of FS, a Root, an os.DirFS or an embed.FS.
+// Requests for a directory are served its Index file or, when Listing is
+// set and there is none, a listing of its files. Listings leave out dotfiles
+// unless ShowHidden is set and show PageSize entries per page,
+// DEFAULT_LISTING_PAGE_SIZE when zero. With Precompressed, clients that
+// accept gzip are sent the name.gz sidecar of a file when there is one.
+type FileServer struct {
+	Index         string
+	FS            fs.FS
+	Listing       bool
+	ShowHidden    bool
+	PageSize      int
+	Precompressed bool
+}
+
+// contentTaggedFS is an fs.FS whose files have no modification time, as
+// those of embed.FS, with entity tags computed from their content.
+type contentTaggedFS struct {
+	fs.FS
+	etags map[string]string
+}
+
+// taggedInfo gives a file the entity tag FileValidators uses.
+type taggedInfo struct {
+	fs.FileInfo
+	etag string
+}
+
+// Static serves the files under dir at prefix, so /prefix/a/b.txt is read
+// from dir/a/b.txt. Precompressed sidecars are served. The returned
+// FileServer can be configured before the server starts.
+func (router *Router) Static(prefix, dir string) *FileServer {
+	return router.serveFiles(prefix, &FileServer{Index: DEFAULT_INDEX_FILE, FS: NewRoot(dir), Precompressed: true})
+}
+
+// StaticFS serves the files of fsys at prefix, like Static. Files without a
+// modification time, as those of embed.FS, are read once here to compute
+// their entity tags.
+func (router *Router) StaticFS(prefix string, fsys fs.FS) *FileServer {
+	return router.serveFiles(prefix, &FileServer{Index: DEFAULT_INDEX_FILE, FS: newContentTaggedFS(fsys), Precompressed: true})
+}
+
+func (router *Router) serveFiles(prefix string, fileServer *FileServer) *FileServer {
+	router.Get(prefix, fileServer.Handler)
+	router.Get(joinPaths(prefix, "[*path]"), fileServer.Handler)
+
+	return fileServer
+}
+
+func (fileServer *FileServer) Handler(protocol *HTTPProtocol, response *HTTPResponse) {
+	name := strings.TrimPrefix(path.Clean("/"+protocol.RouteParams["path"]), "/")
+	if name == "" {
+		name = "."
+	}
+
+	// Relative links in an index file resolve against the directory only
+	// when its path ends with a slash.
+	info, err := fs.Stat(fileServer.FS, name)
+	if err == nil && info.IsDir() && !strings.HasSuffix(protocol.Path, "/") {
+		redirectToDir(response, protocol)
+		return
+	}
+
+	if err == nil && info.IsDir() && fileServer.Listing && !fileServer.hasIndex(name) {
+		serveListing(response, protocol, fileServer.FS, name, fileServer.ShowHidden, fileServer.PageSize)
+		return
+	}
+
+	serveFS(response, protocol, fileServer.FS, name, fileServer.Index, fileServer.Precompressed)
+}
+
+func (fileServer *FileServer) hasIndex(dir string) bool {
+	if fileServer.Index == "" {
+		return false
+	}
+
+	info, err := fs.Stat(fileServer.FS, path.Join(dir, fileServer.Index))
+	return err == nil && !info.IsDir()
+}
+
+// newContentTaggedFS computes the entity tags of the files of fsys that
+// have no modification time. Files that cannot be read are left without
+// one and fail when they are served.
+func newContentTaggedFS(fsys fs.FS) contentTaggedFS {
+	etags := map[string]string{}
+
+	fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().IsZero() {
+			return nil
+		}
+
+		if content, err := fs.ReadFile(fsys, name); err == nil {
+			etags[name] = ContentETag(content)
+		}
+		return nil
+	})
+
+	return contentTaggedFS{fsys, etags}
+}
+
+func (info taggedInfo) ETag() string {
+	return info.etag
+}
+
+// ServeFile sends the file at path with its Content-Type and Content-Length.
+// A directory is served its index.html file. The path is used as it is, use
+// ServeFS with a Root to serve names that come from the request.
+func ServeFile(response *HTTPResponse, protocol *HTTPProtocol, filePath string) {
+	dir, name := filepath.Split(filepath.Clean(filePath))
+	if dir == "" {
+		dir = "."
+	}
+
+	serveFS(response, protocol, os.DirFS(dir), name, DEFAULT_INDEX_FILE, false)
+}
+
+// ServeFS sends the named file of fsys, like ServeFile.
+func ServeFS(response *HTTPResponse, protocol *HTTPProtocol, fsys fs.FS, name string) {
+	serveFS(response, protocol, fsys, name, DEFAULT_INDEX_FILE, false)
+}
+
+func serveFS(response *HTTPResponse, protocol *HTTPProtocol, fsys fs.FS, name string, index string, precompressed bool) {
+	file, info, err := openFile(fsys, name)
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+	defer file.Close()
+
+	if info.IsDir() {
+		file.Close()
+		if index == "" {
+			sendFileError(response, fs.ErrNotExist)
+			return
+		}
+		serveFS(response, protocol, fsys, path.Join(name, index), "", precompressed)
+		return
+	}
+
+	content, err := readSeeker(file)
+	if err != nil {
+		sendFileError(response, err)
+		return
+	}
+
+	if precompressed && servePrecompressed(response, protocol, fsys, name, content) {
+		return
+	}
+
+	serveContent(response, protocol, info, content)
+}
+
+// openFile opens the named file of fsys with its info, which carries the
+// entity tag a contentTaggedFS computed for it.
+func openFile(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if tagged, ok := fsys.(contentTaggedFS); ok && tagged.etags[name] != "" {
+		info = taggedInfo{info, tagged.etags[name]}
+	}
+
+	return file, info, nil
+}
+
+// readSeeker reads files that cannot seek into memory.
+func readSeeker(file fs.File) (io.ReadSeeker, error) {
+	if content, ok := file.(io.ReadSeeker); ok {
+		return content, nil
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// servePrecompressed sends the gzip sidecar of name in its place, with the
+// Content-Type of name, when the client accepts gzip. The compress
+// middleware leaves it alone since it has a Content-Encoding. Whenever there
+// is a sidecar the response depends on Accept-Encoding, so Vary is set even
+// when name is sent. It returns false when name has to be sent.
+func servePrecompressed(response *HTTPResponse, protocol *HTTPProtocol, fsys fs.FS, name string, content io.ReadSeeker) bool {
+	sidecar, info, err := openFile(fsys, name+GZIP_SIDECAR_SUFFIX)
+	if err != nil {
+		return false
+	}
+	defer sidecar.Close()
+
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	addVary(response, "Accept-Encoding")
+
+	if encoding, _ := negotiateEncoding(protocol.Headers["Accept-Encoding"], []string{ENCODING_GZIP}); encoding != ENCODING_GZIP {
+		return false
+	}
+
+	sidecarContent, err := readSeeker(sidecar)
+	if err != nil {
+		return false
+	}
+
+	if response.GetHeader("Content-Type") == "" {
+		contentType, err := detectContentType(name, content)
+		if err != nil {
+			sendFileError(response, err)
+			return true
+		}
+		response.SetHeader("Content-Type", contentType)
+	}
+	response.SetHeader("Content-Encoding", ENCODING_GZIP)
+
+	serveContent(response, protocol, info, sidecarContent)
+	return true
+}
+
+// serveContent streams content, detecting its Content-Type from the name
+// extension or, failing that, from its first bytes. Conditional requests
+// are evaluated first, and GET requests with a Range header are sent only
+// the ranges they ask for, as are HEAD requests.
+func serveContent(response *HTTPResponse, protocol *HTTPProtocol, info fs.FileInfo, content io.ReadSeeker) {
+	size := info.Size()
+
+	if response.GetHeader("Content-Type") == "" {
+		contentType, err := detectContentType(info.Name(), content)
+		if err != nil {
+			sendFileError(response, err)
+			return
+		}
+		response.SetHeader("Content-Type", contentType)
+	}
+
+	if checkPreconditions(response, protocol, FileValidators(info), int(size)) {
+		return
+	}
+
+	response.SetHeader("Accept-Ranges", RANGE_UNIT_BYTES)
+
+	if (protocol.method == "GET" || protocol.method == "HEAD") && rangeApplies(protocol, response, info.ModTime()) {
+		ranges, err := parseRange(headerValue(protocol.Headers, "Range"), size)
+		if err == errUnsatisfiableRange {
+			sendRangeNotSatisfiable(response, size)
+			return
+		}
+
+		// Ranges that add up to more than the whole are likely an attempt
+		// to have the server do extra work, the whole is sent instead.
+		if err == nil && sumRanges(ranges) <= size {
+			serveRanges(response, response.GetHeader("Content-Type"), size, content, ranges, protocol.method == "HEAD")
+			return
+		}
+	}
+
+	response.SetHeader("Content-Length", strconv.FormatInt(size, 10))
+
+	if protocol.method != "HEAD" {
+		io.CopyN(response, content, size)
+	}
+	response.Close()
+}
+
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType, nil
+	}
+
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(content, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return http.DetectContentType(buffer[:n]), nil
+}
+
+func sendFileError(response *HTTPResponse, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid),
+		errors.Is(err, ErrPathEscapesRoot), errors.Is(err, ErrSymlinkRefused):
+		response.StatusCode(HttpStatus.NotFound)
+	case errors.Is(err, fs.ErrPermission):
+		response.StatusCode(HttpStatus.Forbidden)
+	default:
+		response.StatusCode(HttpStatus.InternalSeverError)
+		response.Body(err.Error())
+	}
+
+	response.Send()
+}
+
+// addVary adds key to the Vary header unless it is there already.
+func addVary(response *HTTPResponse, key string) {
+	if !slices.Contains(response.customHeaders["Vary"], key) {
+		response.AddHeader("Vary", key)
+	}
+}
+
+// redirectToDir redirects to the path of the request with a trailing slash,
+// keeping the query. The location is relative, ./name/, so that it stays
+// right under Mount, which strips the prefix off protocol.Path, and can never
+// be taken for the URL of another host, as //name/ would.
+func redirectToDir(response *HTTPResponse, protocol *HTTPProtocol) {
+	location := "./" + path.Base(protocol.Path) + "/"
+	if protocol.rawQuery != "" {
+		location += "?" + protocol.rawQuery
+	}
+
+	redirect(response, location)
+}
+
+func redirect(response *HTTPResponse, location string) {
+	response.SetHeader("Location", location)
+	response.StatusCode(HttpStatus.MovedPermanently)
+	response.Send()
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doRequest(t *testing.T, router *Router, request string) *http.Response {
+	client, server := net.Pipe()
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	go client.Write([]byte(request))
+	go router.connectionHandler(server)
+
+	response, err := http.ReadResponse(bufio.NewReader(client), nil)
+	assert.Nil(t, err)
+
+	return response
+}
+
+func readBody(t *testing.T, response *http.Response) string {
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+
+	return string(body)
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filePath), 0o755))
+		assert.Nil(t, os.WriteFile(filePath, []byte(content), 0o644))
+	}
+
+	return dir
+}
+
+func TestServeFile(t *testing.T) {
+	large := strings.Repeat("0123456789", 1000)
+	dir := writeFiles(t, map[string]string{
+		"large.txt": large,
+		"page":      "<!DOCTYPE html><html><body>sniffed</body></html>",
+		"empty.txt": "",
+	})
+	router := Create()
+
+	router.Get("/files/[filename]", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, filepath.Join(dir, protocol.RouteParams["filename"]))
+	})
+
+	response := doRequest(t, &router, "GET /files/large.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Equal(t, "10000", response.Header.Get("Content-Length"))
+	assert.Equal(t, large, readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/page HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "text/html; charset=utf-8", response.Header.Get("Content-Type"))
+
+	response = doRequest(t, &router, "GET /files/empty.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "0", response.Header.Get("Content-Length"))
+	assert.Equal(t, "", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /files/missing.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestServeFileRelativePath(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(writeFiles(t, map[string]string{"a.txt": "relative"})))
+	t.Cleanup(func() { os.Chdir(wd) })
+	router := Create()
+
+	router.Get("/a", func(protocol *HTTPProtocol, response *HTTPResponse) {
+		ServeFile(response, protocol, "a.txt")
+	})
+
+	response := doRequest(t, &router, "GET /a HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "relative", readBody(t, response))
+}
+
+func TestStatic(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"index.html":        "<h1>home</h1>",
+		"css/site.css":      "body {}",
+		"docs/index.html":   "<h1>docs</h1>",
+		"empty/placeholder": "",
+	})
+	router := Create()
+	router.Static("/static", dir)
+
+	response := doRequest(t, &router, "GET /static/css/site.css HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "text/css; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Equal(t, "body {}", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /static/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "<h1>home</h1>", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /static/docs HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 301, response.StatusCode)
+	assert.Equal(t, "./docs/", response.Header.Get("Location"))
+
+	response = doRequest(t, &router, "GET /static/docs/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "<h1>docs</h1>", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /static/empty/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+
+	response = doRequest(t, &router, "GET /static/missing.js HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+// followRedirects requests target and the locations it is redirected to,
+// returning the last response and the path it was for.
+func followRedirects(t *testing.T, router *Router, target string) (*http.Response, string) {
+	current, _ := url.Parse("http://example.com" + target)
+
+	for range 5 {
+		response := doRequest(t, router, "GET "+current.RequestURI()+" HTTP/1.1\r\n\r\n")
+		if response.StatusCode != 301 {
+			return response, current.RequestURI()
+		}
+
+		location, err := url.Parse(response.Header.Get("Location"))
+		assert.Nil(t, err)
+		current = current.ResolveReference(location)
+		assert.Equal(t, "example.com", current.Host, "redirected to another host")
+	}
+
+	t.Fatalf("too many redirects for %s", target)
+	return nil, ""
+}
+
+func TestStaticDirectoryRedirects(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"docs/index.html": "<h1>docs</h1>"})
+	router := Create()
+	router.Static("/static", dir)
+
+	assets := Create()
+	assets.Static("/files", dir)
+	router.Mount("/assets", &assets)
+
+	for target, expected := range map[string]string{
+		"/static/docs":          "/static/docs/",
+		"/static/docs?lang=en":  "/static/docs/?lang=en",
+		"/assets/files/docs":    "/assets/files/docs/",
+		"/assets/files/docs/":   "/assets/files/docs/",
+		"/assets/files/docs?x=": "/assets/files/docs/?x=",
+	} {
+		response, final := followRedirects(t, &router, target)
+		assert.Equal(t, 200, response.StatusCode, target)
+		assert.Equal(t, expected, final, target)
+		assert.Equal(t, "<h1>docs</h1>", readBody(t, response), target)
+	}
+
+	// //static/docs/ would be a URL of the host named static.
+	response := doRequest(t, &router, "GET //static/docs HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 301, response.StatusCode)
+	assert.Equal(t, "./docs/", response.Header.Get("Location"))
+}
+
+func TestStaticMountedServeHTTP(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"docs/index.html": "<h1>docs</h1>"})
+	assets := Create()
+	assets.Static("/files", dir)
+	router := Create()
+	router.Mount("/assets", &assets)
+
+	server := httptest.NewServer(&router)
+	defer server.Close()
+
+	// The client follows the redirect to the directory.
+	response, err := http.Get(server.URL + "/assets/files/docs")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "/assets/files/docs/", response.Request.URL.Path)
+	assert.Equal(t, "<h1>docs</h1>", readBody(t, response))
+}
+
+func TestStaticFS(t *testing.T) {
+	// Like embed.FS, MapFS files have no modification time unless set.
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<h1>app</h1>")},
+		"assets/app.js": {Data: []byte("console.log('app')")},
+	}
+	router := Create()
+	router.StaticFS("/ui", fsys)
+
+	response := doRequest(t, &router, "GET /ui/assets/app.js HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "text/javascript; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Equal(t, ContentETag([]byte("console.log('app')")), response.Header.Get("ETag"))
+	assert.Equal(t, "", response.Header.Get("Last-Modified"))
+	assert.Equal(t, "console.log('app')", readBody(t, response))
+
+	etag := response.Header.Get("ETag")
+	response = doRequest(t, &router, "GET /ui/assets/app.js HTTP/1.1\r\nIf-None-Match: "+etag+"\r\n\r\n")
+	assert.Equal(t, 304, response.StatusCode)
+
+	response = doRequest(t, &router, "GET /ui/assets/app.js HTTP/1.1\r\nRange: bytes=0-6\r\nIf-Range: "+etag+"\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.Equal(t, "console", readBody(t, response))
+
+	response = doRequest(t, &router, "GET /ui/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "<h1>app</h1>", readBody(t, response))
+	assert.Equal(t, ContentETag([]byte("<h1>app</h1>")), response.Header.Get("ETag"))
+
+	response = doRequest(t, &router, "GET /ui/assets HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 301, response.StatusCode)
+
+	response = doRequest(t, &router, "GET /ui/missing.js HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestStaticFSWithModTimes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "hello"})
+	router := Create()
+	router.StaticFS("/dir", os.DirFS(dir))
+
+	info, err := os.Stat(filepath.Join(dir, "a.txt"))
+	assert.Nil(t, err)
+
+	response := doRequest(t, &router, "GET /dir/a.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, FileValidators(info).ETag, response.Header.Get("ETag"))
+	assert.NotEqual(t, "", response.Header.Get("Last-Modified"))
+	assert.Equal(t, "hello", readBody(t, response))
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	bundle := strings.Repeat("console.log('bundle');\n", 100)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	// The name in the header tells the sidecar from compressed responses.
+	writer.Name = "app.js"
+	writer.Write([]byte(bundle))
+	writer.Close()
+
+	dir := writeFiles(t, map[string]string{"app.js": bundle, "app.js.gz": compressed.String()})
+	router := Create()
+	router.Use(Compress())
+	router.Static("/static", dir)
+
+	response := doRequest(t, &router, "GET /static/app.js HTTP/1.1\r\nAccept-Encoding: gzip, deflate\r\n\r\n")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "text/javascript; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"Accept-Encoding"}, response.Header.Values("Vary"))
+	assert.Equal(t, strconv.Itoa(compressed.Len()), response.Header.Get("Content-Length"))
+	assert.Equal(t, compressed.String(), readBody(t, response))
+	sidecarETag := response.Header.Get("ETag")
+
+	response = doRequest(t, &router, "GET /static/app.js HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, []string{"Accept-Encoding"}, response.Header.Values("Vary"))
+	assert.NotEqual(t, sidecarETag, response.Header.Get("ETag"))
+	assert.Equal(t, bundle, readBody(t, response))
+
+	response = doRequest(t, &router, "GET /static/app.js HTTP/1.1\r\nAccept-Encoding: gzip;q=0, identity\r\n\r\n")
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, bundle, readBody(t, response))
+
+	response = doRequest(t, &router, "GET /static/app.js HTTP/1.1\r\nAccept-Encoding: gzip\r\nIf-None-Match: "+sidecarETag+"\r\n\r\n")
+	assert.Equal(t, 304, response.StatusCode)
+
+	router.Static("/plain", dir).Precompressed = false
+	response = doRequest(t, &router, "GET /plain/app.js HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.NotEqual(t, compressed.String(), readBody(t, response))
+}
+
+// countingFS counts the bytes read from the files it opens.
+type countingFS struct {
+	fs.FS
+	read *int64
+}
+
+type countingFile struct {
+	fs.File
+	read *int64
+}
+
+func (fsys countingFS) Open(name string) (fs.File, error) {
+	file, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingFile{file, fsys.read}, nil
+}
+
+func (file countingFile) Read(b []byte) (int, error) {
+	n, err := file.File.Read(b)
+	*file.read += int64(n)
+	return n, err
+}
+
+func (file countingFile) Seek(offset int64, whence int) (int64, error) {
+	return file.File.(io.Seeker).Seek(offset, whence)
+}
+
+func TestStaticHeadDoesNotReadBody(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var read int64
+	fsys := countingFS{fstest.MapFS{
+		"big.txt": {Data: bytes.Repeat([]byte("a"), 1<<20), ModTime: modTime},
+	}, &read}
+
+	router := Create()
+	router.Use(Compress())
+	router.StaticFS("/files", fsys)
+
+	response, body := doHeadRequest(t, &router, "/files/big.txt")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, strconv.Itoa(1<<20), response.Header.Get("Content-Length"))
+	assert.Equal(t, "", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", body)
+	assert.Equal(t, int64(0), read)
+
+	response = doRequest(t, &router, "HEAD /files/big.txt HTTP/1.1\r\nRange: bytes=0-9,100-\r\n\r\n")
+	assert.Equal(t, 206, response.StatusCode)
+	assert.NotEqual(t, "", response.Header.Get("Content-Length"))
+	assert.Equal(t, int64(0), read)
+
+	response = doRequest(t, &router, "GET /files/big.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 1<<20, len(readBody(t, response)))
+	assert.Equal(t, int64(1<<20), read)
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Storage is where the files of a Files resource are kept. Names are slash
+// separated and relative to the storage, as in fs.FS. Open and Stat return
+// errors wrapping fs.ErrNotExist for missing files, and Create one wrapping
+// fs.ErrExist when the file exists and overwrite is not set. Create must be
+// atomic: readers see either the previous file or the whole new one.
+type Storage interface {
+	Open(name string) (fs.File, error)
+	Create(name string, content io.Reader, overwrite bool) error
+	Stat(name string) (fs.FileInfo, error)
+	Delete(name string) error
+	List(dir string) ([]fs.FileInfo, error)
+}
+
+// LocalStorage keeps files in a directory on disk, through a Root.
+type LocalStorage struct {
+	Root *Root
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{Root: NewRoot(dir)}
+}
+
+func (storage *LocalStorage) Open(name string) (fs.File, error) {
+	return storage.Root.Open(name)
+}
+
+func (storage *LocalStorage) Create(name string, content io.Reader, overwrite bool) error {
+	if err := validStorageName("create", name); err != nil {
+		return err
+	}
+
+	return storage.Root.WriteFile(name, content, overwrite)
+}
+
+func (storage *LocalStorage) Stat(name string) (fs.FileInfo, error) {
+	return storage.Root.Stat(name)
+}
+
+// Delete removes the named file. Directories are not removed.
+func (storage *LocalStorage) Delete(name string) error {
+	if err := validStorageName("delete", name); err != nil {
+		return err
+	}
+
+	info, err := storage.Root.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "delete", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return storage.Root.Remove(name)
+}
+
+func (storage *LocalStorage) List(dir string) ([]fs.FileInfo, error) {
+	entries, err := fs.ReadDir(storage.Root, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []fs.FileInfo{}
+	for _, entry := range entries {
+		// Stat goes through the Root, so symlinks it refuses to follow are
+		// left out.
+		info, err := storage.Root.Stat(path.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// storageFS serves a Storage as an fs.FS, for the file serving and listing
+// functions.
+type storageFS struct {
+	Storage
+}
+
+func (fsys storageFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := fsys.List(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+// fileInfo describes the files of storages that are not on disk. These
+// storages know the entity tag of their files, which FileValidators uses.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	etag    string
+}
+
+func (info fileInfo) Name() string       { return info.name }
+func (info fileInfo) Size() int64        { return info.size }
+func (info fileInfo) ModTime() time.Time { return info.modTime }
+func (info fileInfo) IsDir() bool        { return info.dir }
+func (info fileInfo) Sys() any           { return nil }
+func (info fileInfo) ETag() string       { return info.etag }
+
+func (info fileInfo) Mode() fs.FileMode {
+	if info.dir {
+		return fs.ModeDir | 0o755
+	}
+
+	return 0o644
+}
+
+// validStorageName checks a name given to a storage, which must be a valid
+// fs.FS path and, to create or delete, name a file rather than the storage
+// itself.
+func validStorageName(op, name string) error {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) || ((op == "create" || op == "delete") && name == ".") {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return nil
+}
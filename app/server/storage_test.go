@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func storageBackends(t *testing.T) map[string]Storage {
+	return map[string]Storage{
+		"local":  NewLocalStorage(t.TempDir()),
+		"memory": NewMemoryStorage(),
+		"s3":     newS3StandIn(t).storage(),
+	}
+}
+
+func TestStorageBackends(t *testing.T) {
+	for name, storage := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, storage.Create("a.txt", strings.NewReader("hello"), false))
+
+			err := storage.Create("a.txt", strings.NewReader("other"), false)
+			assert.True(t, errors.Is(err, fs.ErrExist))
+
+			content, err := fs.ReadFile(storageFS{storage}, "a.txt")
+			assert.Nil(t, err)
+			assert.Equal(t, "hello", string(content))
+
+			assert.Nil(t, storage.Create("a.txt", strings.NewReader("bye"), true))
+			content, _ = fs.ReadFile(storageFS{storage}, "a.txt")
+			assert.Equal(t, "bye", string(content))
+
+			info, err := storage.Stat("a.txt")
+			assert.Nil(t, err)
+			assert.Equal(t, "a.txt", info.Name())
+			assert.Equal(t, int64(3), info.Size())
+			assert.False(t, info.IsDir())
+			assert.NotEqual(t, "", FileValidators(info).ETag)
+
+			assert.Nil(t, storage.Create("b.txt", strings.NewReader("b"), false))
+			infos, err := storage.List(".")
+			assert.Nil(t, err)
+			assert.Len(t, infos, 2)
+
+			assert.Nil(t, storage.Delete("a.txt"))
+			_, err = storage.Stat("a.txt")
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+			_, err = storage.Open("a.txt")
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+			assert.True(t, errors.Is(storage.Delete("a.txt"), fs.ErrNotExist))
+
+			for _, invalid := range []string{"../escape.txt", "/absolute.txt", "."} {
+				assert.True(t, errors.Is(storage.Create(invalid, strings.NewReader("x"), true), fs.ErrInvalid), invalid)
+				assert.True(t, errors.Is(storage.Delete(invalid), fs.ErrInvalid), invalid)
+			}
+		})
+	}
+}
+
+func TestMemoryStorageDirectories(t *testing.T) {
+	storage := NewMemoryStorage()
+	assert.Nil(t, storage.Create("docs/nested/a.txt", strings.NewReader("a"), false))
+
+	info, err := storage.Stat("docs")
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+
+	entries, err := fs.ReadDir(storageFS{storage}, "docs")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, entries[0].IsDir())
+
+	err = storage.Create("docs", strings.NewReader("x"), true)
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+
+	assert.Nil(t, storage.Delete("docs/nested/a.txt"))
+	_, err = storage.Stat("docs")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestFilesOnStorageBackends(t *testing.T) {
+	for name, storage := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			router := Create()
+			router.Files("/files", storage)
+
+			response := doRequest(t, &router, "PUT /files/a.txt HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world")
+			assert.Equal(t, 201, response.StatusCode)
+			etag := response.Header.Get("ETag")
+			assert.NotEqual(t, "", etag)
+
+			response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\n\r\n")
+			assert.Equal(t, 200, response.StatusCode)
+			assert.Equal(t, etag, response.Header.Get("ETag"))
+			assert.Equal(t, "hello world", readBody(t, response))
+
+			response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nRange: bytes=6-\r\n\r\n")
+			assert.Equal(t, 206, response.StatusCode)
+			assert.Equal(t, "world", readBody(t, response))
+
+			response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\nIf-None-Match: "+etag+"\r\n\r\n")
+			assert.Equal(t, 304, response.StatusCode)
+
+			response = doRequest(t, &router, "POST /files/a.txt HTTP/1.1\r\nContent-Length: 3\r\n\r\nnew")
+			assert.Equal(t, 409, response.StatusCode)
+
+			response = doRequest(t, &router, "PUT /files/a.txt HTTP/1.1\r\nIf-Match: \"stale\"\r\nContent-Length: 3\r\n\r\nnew")
+			assert.Equal(t, 412, response.StatusCode)
+
+			response = doRequest(t, &router, "PUT /files/a.txt HTTP/1.1\r\nIf-Match: "+etag+"\r\nContent-Length: 3\r\n\r\nnew")
+			assert.Equal(t, 204, response.StatusCode)
+			assert.NotEqual(t, etag, response.Header.Get("ETag"))
+
+			response = doRequest(t, &router, "GET /files/a.txt?meta HTTP/1.1\r\n\r\n")
+			var meta FileMeta
+			assert.Nil(t, json.Unmarshal([]byte(readBody(t, response)), &meta))
+			assert.Equal(t, int64(3), meta.Size)
+
+			response = doRequest(t, &router, "GET /files/ HTTP/1.1\r\nAccept: application/json\r\n\r\n")
+			var listing Listing
+			assert.Nil(t, json.Unmarshal([]byte(readBody(t, response)), &listing))
+			assert.Equal(t, []string{"a.txt"}, entryNames(listing))
+
+			response = doRequest(t, &router, "DELETE /files/a.txt HTTP/1.1\r\n\r\n")
+			assert.Equal(t, 204, response.StatusCode)
+
+			response = doRequest(t, &router, "GET /files/a.txt HTTP/1.1\r\n\r\n")
+			assert.Equal(t, 404, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// node is a segment of the route tree. Every method has its own tree and a
+// request path is matched one segment at a time, trying the static child
+// first, then the placeholder children and finally the catch-all child, so
+// the match priority does not depend on the registration order. Constrained
+// placeholders are tried before unconstrained ones, in registration order.
+//
+// A catch-all, either the anonymous WILDCARD_CHAR or a named [*name], takes
+// at least one segment. When more segments follow it in the route, it takes
+// the longest run of segments that still lets the rest of the route match.
+type node struct {
+	static     map[string]*node
+	params     []*node
+	constraint *constraint
+	wildcard   *node
+	route      *Route
+}
+
+// insert adds route to the tree, unless a route of the same shape is already
+// there. The first registration wins and the existing route is returned. The
+// params of route are recorded on it, with their constraints, nil for
+// catch-alls and unconstrained placeholders.
+func (tree *node) insert(route *Route) *Route {
+	current := tree
+
+	for _, segment := range getPathSegments(route.path) {
+		if isCatchAll(segment) {
+			route.paramNames = append(route.paramNames, catchAllName(segment))
+			route.constraints = append(route.constraints, nil)
+			if current.wildcard == nil {
+				current.wildcard = &node{}
+			}
+			current = current.wildcard
+			continue
+		}
+
+		if isPlaceholder(segment) {
+			name, constraint := parsePlaceholder(segment)
+			route.paramNames = append(route.paramNames, name)
+			route.constraints = append(route.constraints, constraint)
+			current = current.paramChild(constraint)
+			continue
+		}
+
+		if current.static == nil {
+			current.static = make(map[string]*node)
+		}
+		if _, ok := current.static[segment]; !ok {
+			current.static[segment] = &node{}
+		}
+		current = current.static[segment]
+	}
+
+	if current.route != nil {
+		return current.route
+	}
+
+	current.route = route
+	return nil
+}
+
+func (tree *node) paramChild(constraint *constraint) *node {
+	for _, child := range tree.params {
+		if child.constraint == nil && constraint == nil {
+			return child
+		}
+		if child.constraint != nil && constraint != nil && child.constraint.source == constraint.source {
+			return child
+		}
+	}
+
+	child := &node{constraint: constraint}
+
+	// Keep the unconstrained placeholder, if any, as the last candidate.
+	if constraint != nil && len(tree.params) > 0 && tree.params[len(tree.params)-1].constraint == nil {
+		tree.params = slices.Insert(tree.params, len(tree.params)-1, child)
+	} else {
+		tree.params = append(tree.params, child)
+	}
+
+	return child
+}
+
+func (tree *node) lookup(path string) (*Route, map[string]string) {
+	route, values := tree.match(getPathSegments(path), nil)
+	params := make(map[string]string)
+
+	if route == nil {
+		return nil, params
+	}
+
+	// Params are matched escaped and handed to handlers unescaped.
+	for idx, name := range route.paramNames {
+		if name != "" {
+			params[name] = unescapeSegment(values[idx])
+		}
+	}
+
+	return route, params
+}
+
+// unescapeSegment decodes the percent escapes of a path segment, leaving
+// segments that are not validly escaped as they are.
+func unescapeSegment(segment string) string {
+	if value, err := url.PathUnescape(segment); err == nil {
+		return value
+	}
+
+	return segment
+}
+
+func (tree *node) match(segments []string, values []string) (*Route, []string) {
+	if len(segments) == 0 {
+		return tree.route, values
+	}
+
+	if child, ok := tree.static[segments[0]]; ok {
+		if route, matched := child.match(segments[1:], values); route != nil {
+			return route, matched
+		}
+	}
+
+	for _, child := range tree.params {
+		if !child.constraint.allows(unescapeSegment(segments[0])) {
+			continue
+		}
+		if route, matched := child.match(segments[1:], append(values, segments[0])); route != nil {
+			return route, matched
+		}
+	}
+
+	if tree.wildcard != nil {
+		return tree.wildcard.matchCatchAll(segments, values)
+	}
+
+	return nil, nil
+}
+
+func (tree *node) matchCatchAll(segments []string, values []string) (*Route, []string) {
+	for length := len(segments); length > 0; length-- {
+		capture := strings.Join(segments[:length], "/")
+		if route, matched := tree.match(segments[length:], append(values, capture)); route != nil {
+			return route, matched
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreePriorityIgnoresRegistrationOrder(t *testing.T) {
+	routes := []string{"*", "/files/*", "/files/[filename]", "/files/index"}
+	orders := [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {1, 3, 0, 2}}
+
+	for _, order := range orders {
+		tree := &node{}
+		for _, idx := range order {
+			tree.insert(&Route{path: routes[idx]})
+		}
+
+		route, _ := tree.lookup("/files/index")
+		assert.Equal(t, "/files/index", route.path)
+
+		route, params := tree.lookup("/files/report.txt")
+		assert.Equal(t, "/files/[filename]", route.path)
+		assert.Equal(t, "report.txt", params["filename"])
+
+		route, _ = tree.lookup("/files/nested/report.txt")
+		assert.Equal(t, "/files/*", route.path)
+
+		route, _ = tree.lookup("/other")
+		assert.Equal(t, "*", route.path)
+	}
+}
+
+func TestTreeBacktracksFromStaticToParam(t *testing.T) {
+	tree := &node{}
+	tree.insert(&Route{path: "/users/me/settings"})
+	tree.insert(&Route{path: "/users/[id]/posts"})
+
+	route, params := tree.lookup("/users/me/posts")
+
+	assert.Equal(t, "/users/[id]/posts", route.path)
+	assert.Equal(t, "me", params["id"])
+}
+
+func TestTreeKeepsFirstRegistration(t *testing.T) {
+	tree := &node{}
+	first := &Route{path: "/a"}
+	tree.insert(first)
+	tree.insert(&Route{path: "/a"})
+
+	route, _ := tree.lookup("/a")
+	assert.Same(t, first, route)
+}
+
+func benchmarkLookup(b *testing.B, routeCount int) {
+	tree := &node{}
+	for idx := 0; idx < routeCount; idx++ {
+		tree.insert(&Route{path: fmt.Sprintf("/resource%d/[id]/details", idx)})
+		tree.insert(&Route{path: fmt.Sprintf("/resource%d/static", idx)})
+	}
+	tree.insert(&Route{path: "*"})
+
+	path := fmt.Sprintf("/resource%d/42/details", routeCount-1)
+
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		tree.lookup(path)
+	}
+}
+
+func BenchmarkLookup10Routes(b *testing.B)   { benchmarkLookup(b, 10) }
+func BenchmarkLookup100Routes(b *testing.B)  { benchmarkLookup(b, 100) }
+func BenchmarkLookup1000Routes(b *testing.B) { benchmarkLookup(b, 1000) }
+
+func TestNamedCatchAll(t *testing.T) {
+	tree := &node{}
+	tree.insert(&Route{path: "/static/[*path]"})
+	tree.insert(&Route{path: "/static/index.html"})
+	tree.insert(&Route{path: "/static/[file]"})
+
+	route, params := tree.lookup("/static/css/site/main.css")
+	assert.Equal(t, "/static/[*path]", route.path)
+	assert.Equal(t, "css/site/main.css", params["path"])
+
+	route, _ = tree.lookup("/static/index.html")
+	assert.Equal(t, "/static/index.html", route.path)
+
+	route, params = tree.lookup("/static/app.js")
+	assert.Equal(t, "/static/[file]", route.path)
+	assert.Equal(t, "app.js", params["file"])
+
+	route, _ = tree.lookup("/static")
+	assert.Nil(t, route)
+}
+
+func TestMidTreeCatchAll(t *testing.T) {
+	tree := &node{}
+	tree.insert(&Route{path: "/repos/[owner]/[*path]/raw"})
+	tree.insert(&Route{path: "/repos/[owner]/[*path]/blame/[line:int]"})
+
+	route, params := tree.lookup("/repos/saymow/app/server/server.go/raw")
+	assert.Equal(t, "/repos/[owner]/[*path]/raw", route.path)
+	assert.Equal(t, "saymow", params["owner"])
+	assert.Equal(t, "app/server/server.go", params["path"])
+
+	// The catch-all takes the longest run that lets the rest match.
+	route, params = tree.lookup("/repos/saymow/raw/docs/raw")
+	assert.Equal(t, "/repos/[owner]/[*path]/raw", route.path)
+	assert.Equal(t, "raw/docs", params["path"])
+
+	route, params = tree.lookup("/repos/saymow/main.go/blame/12")
+	assert.Equal(t, "/repos/[owner]/[*path]/blame/[line:int]", route.path)
+	assert.Equal(t, "main.go", params["path"])
+	assert.Equal(t, "12", params["line"])
+
+	route, _ = tree.lookup("/repos/saymow/raw")
+	assert.Nil(t, route)
+}
+
+func TestAnonymousWildcardDoesNotCapture(t *testing.T) {
+	params := getRouteParams("/files/a/b", "/files/*")
+
+	assert.Equal(t, 0, len(params))
+}
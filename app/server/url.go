@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+func (route *Route) Name(name string) *Route {
+	route.name = name
+	return route
+}
+
+// URL builds the path of the route registered with name, escaping the
+// params. Routes of mounted routers are found with their mount prefix.
+func (router *Router) URL(name string, params map[string]string) (string, error) {
+	for _, route := range router.routes {
+		if route.name == name {
+			return route.url(params)
+		}
+	}
+
+	for _, mount := range router.mounts {
+		if path, err := mount.router.URL(name, params); err == nil {
+			return joinPaths(mount.prefix, path), nil
+		} else if _, ok := err.(RouteNotFoundError); !ok {
+			return "", err
+		}
+	}
+
+	return "", RouteNotFoundError{name}
+}
+
+type RouteNotFoundError struct {
+	name string
+}
+
+func (error RouteNotFoundError) Error() string {
+	return fmt.Sprintf("Server error: route %s not found.", error.name)
+}
+
+func (route *Route) url(params map[string]string) (string, error) {
+	segments := []string{}
+	paramIndex := -1
+
+	for _, segment := range getPathSegments(route.path) {
+		// The params were parsed, in order, when the route was inserted.
+		if isCatchAll(segment) || isPlaceholder(segment) {
+			paramIndex++
+		}
+
+		switch {
+		case segment == string(WILDCARD_CHAR):
+			return "", ServerError{fmt.Sprintf("route %s has an anonymous wildcard.", route.name)}
+		case isCatchAll(segment):
+			name := catchAllName(segment)
+			value, ok := params[name]
+			if !ok || value == "" {
+				return "", ServerError{fmt.Sprintf("route %s is missing param %s.", route.name, name)}
+			}
+			for _, part := range getPathSegments(value) {
+				segments = append(segments, url.PathEscape(part))
+			}
+		case isPlaceholder(segment):
+			name, constraint := route.paramNames[paramIndex], route.constraints[paramIndex]
+			value, ok := params[name]
+			if !ok || value == "" {
+				return "", ServerError{fmt.Sprintf("route %s is missing param %s.", route.name, name)}
+			}
+			if !constraint.allows(value) {
+				return "", ServerError{fmt.Sprintf("route %s param %s does not satisfy %s.", route.name, name, constraint.source)}
+			}
+			segments = append(segments, url.PathEscape(value))
+		default:
+			segments = append(segments, segment)
+		}
+	}
+
+	return "/" + strings.Join(segments, "/"), nil
+}
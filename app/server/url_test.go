@@ -0,0 +1,67 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noopHandler(protocol *HTTPProtocol, response *HTTPResponse) {}
+
+func TestRouterURL(t *testing.T) {
+	router := Create()
+	router.Get("/files/[filename]", noopHandler).Name("file")
+	router.Get("/users/[id:int]/posts/[slug]", noopHandler).Name("post")
+	router.Get("/static/[*path]", noopHandler).Name("static")
+	router.Group("/api/v1").Get("/status", noopHandler).Name("status")
+
+	path, err := router.URL("file", map[string]string{"filename": "a.txt"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/files/a.txt", path)
+
+	path, err = router.URL("file", map[string]string{"filename": "my report?.txt"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/files/my%20report%3F.txt", path)
+
+	path, err = router.URL("post", map[string]string{"id": "7", "slug": "hello"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/7/posts/hello", path)
+
+	path, err = router.URL("static", map[string]string{"path": "css/site main.css"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/static/css/site%20main.css", path)
+
+	path, err = router.URL("status", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/api/v1/status", path)
+}
+
+func TestRouterURLErrors(t *testing.T) {
+	router := Create()
+	router.Get("/users/[id:int]", noopHandler).Name("user")
+	router.Get("/assets/*", noopHandler).Name("assets")
+
+	_, err := router.URL("user", map[string]string{})
+	assert.NotNil(t, err)
+
+	_, err = router.URL("user", map[string]string{"id": "abc"})
+	assert.NotNil(t, err)
+
+	_, err = router.URL("assets", map[string]string{})
+	assert.NotNil(t, err)
+
+	_, err = router.URL("missing", nil)
+	assert.IsType(t, RouteNotFoundError{}, err)
+}
+
+func TestMountedRouterURL(t *testing.T) {
+	admin := Create()
+	admin.Get("/users/[id]", noopHandler).Name("admin-user")
+
+	router := Create()
+	router.Mount("/admin", &admin)
+
+	path, err := router.URL("admin-user", map[string]string{"id": "3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/admin/users/3", path)
+}